@@ -0,0 +1,117 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Aggregator collects file results, possibly from several goroutines, and
+// turns them into the one ordered result set every output renders. Merging,
+// de-duplication, severity classification and ordering all happen here, so
+// the comment, check run and machine-readable outputs always agree.
+type Aggregator struct {
+	mu     sync.Mutex
+	config *Config
+	byFile map[string]*FileAnalysisResult
+	order  []string
+}
+
+func NewAggregator(config *Config) *Aggregator {
+	return &Aggregator{
+		config: config,
+		byFile: make(map[string]*FileAnalysisResult),
+	}
+}
+
+// Add merges a file's results into the set. Results for a file that was
+// already added are appended to it.
+func (a *Aggregator) Add(results ...*FileAnalysisResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, result := range results {
+		existing, ok := a.byFile[result.Filename]
+		if !ok {
+			existing = &FileAnalysisResult{Filename: result.Filename, SHA: result.SHA}
+			a.byFile[result.Filename] = existing
+			a.order = append(a.order, result.Filename)
+		} else if existing.SHA == "" {
+			existing.SHA = result.SHA
+		}
+		existing.Issues = append(existing.Issues, result.Issues...)
+	}
+}
+
+// Results returns the aggregated results. Within a file, duplicate issues
+// (same type, line and message) are dropped, every issue gets its severity,
+// and issues are ordered by line, type and message. Files are ordered by
+// comment.sortBy; only with sortBy "none" does the order results were added
+// in show through.
+func (a *Aggregator) Results() []*FileAnalysisResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	results := make([]*FileAnalysisResult, 0, len(a.order))
+	for _, filename := range a.order {
+		result := a.byFile[filename]
+		results = append(results, &FileAnalysisResult{
+			Filename: result.Filename,
+			SHA:      result.SHA,
+			Issues:   a.normalizeIssues(result.Issues),
+		})
+	}
+	sortResults(results, a.config)
+	return results
+}
+
+// normalizeIssues sorts the issues on all their fields before dropping
+// duplicates, so which of two duplicates is kept doesn't depend on the
+// order they came in.
+func (a *Aggregator) normalizeIssues(issues []Issue) []Issue {
+	sorted := slices.Clone(issues)
+	slices.SortFunc(sorted, compareIssues)
+	seen := make(map[string]bool, len(sorted))
+	normalized := make([]Issue, 0, len(sorted))
+	for _, issue := range sorted {
+		key := fmt.Sprintf("%s\x00%d\x00%s", issue.Type, issue.Line, strings.ToLower(strings.TrimSpace(issue.Message)))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		issue.Severity = issueSeverity(issue, a.config)
+		normalized = append(normalized, issue)
+	}
+	return normalized
+}
+
+// compareIssues orders issues by line, type and message, then by their
+// remaining fields.
+func compareIssues(x, y Issue) int {
+	if c := cmp.Compare(x.Line, y.Line); c != 0 {
+		return c
+	}
+	for _, pair := range [][2]string{
+		{x.Type, y.Type},
+		{x.Message, y.Message},
+		{x.Severity, y.Severity},
+		{x.Category, y.Category},
+		{x.Suggestion, y.Suggestion},
+		{x.SuggestedCode, y.SuggestedCode},
+	} {
+		if c := cmp.Compare(pair[0], pair[1]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(x.EndLine, y.EndLine)
+}
+
+// aggregate runs result sets through a fresh Aggregator.
+func aggregate(config *Config, sets ...[]*FileAnalysisResult) []*FileAnalysisResult {
+	agg := NewAggregator(config)
+	for _, set := range sets {
+		agg.Add(set...)
+	}
+	return agg.Results()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func testResults() []*FileAnalysisResult {
+	return []*FileAnalysisResult{
+		{Filename: "b.go", SHA: "b1", Issues: []Issue{
+			{Type: "naming", Message: "Rename x", Line: 10},
+			{Type: "security", Message: "SQL injection", Line: 3},
+			{Type: "naming", Message: "rename x ", Line: 10, Suggestion: "Use count"},
+			{Type: "docs", Message: "Missing doc", Line: 3, Category: "docs"},
+		}},
+		{Filename: "a.go", SHA: "a1", Issues: []Issue{
+			{Type: "style", Message: "Long line", Line: 7},
+			{Type: "style", Message: "Long line", Line: 7, Suggestion: "Wrap it"},
+			{Type: "security", Message: "Hard-coded secret"},
+		}},
+		{Filename: "c.go", SHA: "c1"},
+	}
+}
+
+// shuffled returns a copy of results with the files and the issues of each
+// file in random order, split over several result sets.
+func shuffled(rng *rand.Rand, results []*FileAnalysisResult) [][]*FileAnalysisResult {
+	var parts []*FileAnalysisResult
+	for _, result := range results {
+		issues := append([]Issue(nil), result.Issues...)
+		rng.Shuffle(len(issues), func(i, j int) { issues[i], issues[j] = issues[j], issues[i] })
+		split := rng.Intn(len(issues) + 1)
+		parts = append(parts,
+			&FileAnalysisResult{Filename: result.Filename, SHA: result.SHA, Issues: issues[:split]},
+			&FileAnalysisResult{Filename: result.Filename, SHA: result.SHA, Issues: issues[split:]},
+		)
+	}
+	rng.Shuffle(len(parts), func(i, j int) { parts[i], parts[j] = parts[j], parts[i] })
+	split := rng.Intn(len(parts) + 1)
+	return [][]*FileAnalysisResult{parts[:split], parts[split:]}
+}
+
+func TestAggregateIsDeterministicUnderShuffledInput(t *testing.T) {
+	for _, sortBy := range []string{"", "filename", "severity"} {
+		config := &Config{}
+		config.Severity.Error = []string{"security"}
+		config.Comment.SortBy = sortBy
+		want := aggregate(config, testResults())
+
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 200; i++ {
+			got := aggregate(config, shuffled(rng, testResults())...)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("sortBy %q, shuffle %d: got %s, want %s", sortBy, i, describe(got), describe(want))
+			}
+		}
+	}
+}
+
+func TestAggregateDropsDuplicatesAndOrdersIssues(t *testing.T) {
+	config := &Config{}
+	config.Severity.Error = []string{"security"}
+	results := aggregate(config, testResults())
+
+	var filenames []string
+	for _, result := range results {
+		filenames = append(filenames, result.Filename)
+	}
+	if want := []string{"a.go", "b.go", "c.go"}; !reflect.DeepEqual(filenames, want) {
+		t.Errorf("files = %v, want %v", filenames, want)
+	}
+
+	b := results[1].Issues
+	if len(b) != 3 {
+		t.Fatalf("b.go has %d issues, want 3 after dropping the duplicate: %+v", len(b), b)
+	}
+	if b[0].Type != "docs" || b[1].Type != "security" || b[2].Type != "naming" {
+		t.Errorf("b.go issues are not ordered by line and type: %+v", b)
+	}
+	if b[1].Severity != "error" || b[2].Severity != "warning" {
+		t.Errorf("severities = %q, %q, want error, warning", b[1].Severity, b[2].Severity)
+	}
+}
+
+func TestIssueSeverity(t *testing.T) {
+	config := &Config{}
+	config.Severity.Error = []string{"security"}
+	tests := []struct {
+		issue Issue
+		want  string
+	}{
+		{Issue{Type: "security"}, "error"},
+		{Issue{Type: "naming"}, "warning"},
+		// Set by a post-process command or heuristic.
+		{Issue{Type: "naming", Severity: "error"}, "error"},
+	}
+	for _, test := range tests {
+		if got := issueSeverity(test.issue, config); got != test.want {
+			t.Errorf("issueSeverity(%+v) = %q, want %q", test.issue, got, test.want)
+		}
+	}
+}
+
+type fixedProvider struct {
+	result *AnalysisResult
+}
+
+func (p *fixedProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	result := *p.result
+	result.Issues = append([]Issue(nil), p.result.Issues...)
+	return &result, nil
+}
+
+func TestAnalyzeFilesIgnoresModelSeverity(t *testing.T) {
+	config := &Config{}
+	config.Severity.Error = []string{"security"}
+	analyzer := &Analyzer{
+		Config: config,
+		Provider: &fixedProvider{result: &AnalysisResult{Issues: []Issue{
+			{Type: "security", Message: "SQL injection", Line: 1, Severity: "warning"},
+			{Type: "naming", Message: "Rename x", Line: 2, Severity: "blocker"},
+		}}},
+	}
+	report := analyzer.AnalyzeFiles(context.Background(), []*ChangedFile{{Filename: "a.go", Patch: "@@ -0,0 +1,2 @@\n+a\n+b"}})
+	if len(report.Results) != 1 || len(report.Results[0].Issues) != 2 {
+		t.Fatalf("unexpected results: %s", describe(report.Results))
+	}
+	issues := report.Results[0].Issues
+	if issues[0].Severity != "error" || issues[1].Severity != "warning" {
+		t.Errorf("severities = %q, %q, want error, warning", issues[0].Severity, issues[1].Severity)
+	}
+}
+
+func describe(results []*FileAnalysisResult) string {
+	out := ""
+	for _, result := range results {
+		out += result.Filename + ":"
+		for _, issue := range result.Issues {
+			out += " [" + issue.Type + " " + issue.Message + " " + issue.Severity + " " + issue.Suggestion + "]"
+		}
+		out += "; "
+	}
+	return out
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// progress receives the log of an analysis: the files being analyzed,
+// retries and fallbacks. It is stdout, unless the results are printed
+// there.
+var progress io.Writer = os.Stdout
+
+// Analyzer holds everything needed to analyze the files of one run.
+type Analyzer struct {
+	Config *Config
+	// Rules is the default rules document, used for files that match no
+	// rulesMap pattern.
+	Rules string
+	// MappedRules holds the content of each rules file named in rulesMap,
+	// keyed by its path.
+	MappedRules map[string]string
+	APIKey      string
+	Provider    LLMProvider
+	Diag        *diagnosticWriter
+	// RepoContext is project-wide background sent with every file, after
+	// the rules.
+	RepoContext string
+	// DocsRules is the rules document for the docs pass, if enabled.
+	DocsRules string
+	// Packages holds the package configs found for the changed files,
+	// keyed by package directory. See discoverPackageConfigs.
+	Packages map[string]*PackageConfig
+	// FetchFile returns the content of a repository file at the head of the
+	// pull request. It is only set when context requests are enabled.
+	FetchFile func(ctx context.Context, path string) (string, error)
+
+	formatViolations int
+	usage            TokenUsage
+}
+
+// AnalyzeFiles runs the provider over every file in order, stopping early
+// when the job is cancelled or the token budget is spent.
+func (a *Analyzer) AnalyzeFiles(ctx context.Context, files []*ChangedFile) *Report {
+	config := a.Config
+	report := &Report{}
+	results := NewAggregator(config)
+	spentTokens := 0
+	for i, file := range files {
+		if ctx.Err() != nil {
+			report.Interrupted = true
+			break
+		}
+
+		if config.Budget.MaxTokens > 0 {
+			cost := estimateTokens(buildPrompt(file.Patch, config, selectRules(a.rulesFor(file.Filename), file.Filename), a.RepoContext))
+			if spentTokens+cost > config.Budget.MaxTokens {
+				fmt.Fprintf(progress, "Token budget of %d reached, skipping %d remaining file(s).\n", config.Budget.MaxTokens, len(files)-i)
+				report.BudgetReached = true
+				for _, skipped := range files[i:] {
+					report.NotAnalyzed = append(report.NotAnalyzed, skipped.Filename)
+				}
+				break
+			}
+			spentTokens += cost
+		}
+
+		issues, err := a.analyzeFile(ctx, file)
+		if err != nil {
+			if ctx.Err() != nil {
+				report.Interrupted = true
+				break
+			}
+			fmt.Fprintf(progress, "Error analyzing patch for %s: %v\n", file.Filename, err)
+			report.Failed = append(report.Failed, file.Filename)
+			continue
+		}
+		result := &FileAnalysisResult{
+			Filename: file.Filename,
+			SHA:      file.SHA,
+			Issues:   issues,
+		}
+		if err := a.Diag.writeResult(result, config); err != nil {
+			fmt.Fprintf(progress, "Error writing diagnostics for %s: %v\n", file.Filename, err)
+		}
+		results.Add(result)
+		report.Analyzed = append(report.Analyzed, file.Filename)
+	}
+	if cacher, ok := a.Provider.(RulesCacher); ok {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownGracePeriod)
+		cacher.ReleaseCachedRules(releaseCtx)
+		cancel()
+	}
+	report.Results = results.Results()
+	report.TotalFiles = len(files)
+	report.FormatViolations = a.formatViolations
+	report.Usage = a.usage
+	return report
+}
+
+// analyzeFile returns the issues for one file: those found in the patch
+// against the main rules, followed by those found in its doc comments when
+// the docs pass is enabled. Severities are left to the config.
+func (a *Analyzer) analyzeFile(ctx context.Context, file *ChangedFile) ([]Issue, error) {
+	issues, err := a.modelIssues(ctx, file)
+	for i := range issues {
+		issues[i].Severity = ""
+	}
+	return issues, err
+}
+
+func (a *Analyzer) modelIssues(ctx context.Context, file *ChangedFile) ([]Issue, error) {
+	provider := a.providerFor(file.Filename, detectLanguage(file.Filename), addedLineCount(file.Patch))
+	rules := selectRules(a.rulesFor(file.Filename), file.Filename)
+	analysis, err := a.analyze(ctx, provider, file.Patch, rules)
+	if err != nil {
+		return nil, err
+	}
+	issues := analysis.Issues
+	if len(issues) == 0 && a.Config.AI.EmptyRetry.applies(file.Patch) {
+		issues = a.retryEmpty(ctx, provider, file.Filename, file.Patch, rules)
+	}
+
+	if !a.Config.Docs.Enabled {
+		return issues, nil
+	}
+	docs := extractDocComments(file.Filename, file.Patch)
+	if docs == "" {
+		return issues, nil
+	}
+	category := a.Config.Docs.Category
+	if category == "" {
+		category = "docs"
+	}
+	docsAnalysis, err := a.analyze(ctx, a.providerFor(file.Filename, category, addedLineCount(file.Patch)), docs, selectRules(a.DocsRules, file.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("docs pass: %w", err)
+	}
+	for _, issue := range docsAnalysis.Issues {
+		issue.Category = category
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// analyze sends one patch to the provider. With context requests enabled the
+// model may ask for files it needs to see; those are fetched and the patch is
+// re-prompted exactly once, so a run never spends more than two calls on it.
+func (a *Analyzer) analyze(ctx context.Context, provider LLMProvider, patch, rules string) (*AnalysisResult, error) {
+	if cacher, ok := provider.(RulesCacher); ok && rules != "" {
+		if cached, ok := cacher.WithCachedRules(ctx, rules, a.APIKey); ok {
+			provider = cached
+		}
+	}
+	prompt := buildPrompt(patch, a.Config, rules, a.RepoContext)
+	if !a.Config.AI.ContextRequests.Enabled || a.FetchFile == nil {
+		return a.call(ctx, provider, patch, prompt)
+	}
+
+	prompt += contextRequestInstructions
+	result, err := a.call(ctx, provider, patch, prompt)
+	if err != nil || len(result.NeedContext) == 0 {
+		return result, err
+	}
+
+	extra := a.resolveContextRequests(ctx, result.NeedContext)
+	prompt += "\n\nRequested context:\n" + extra + "\nDo not request more context. Report the issues now."
+	result, err = a.call(ctx, provider, patch, prompt)
+	if err != nil {
+		return nil, err
+	}
+	result.NeedContext = nil
+	return result, nil
+}
+
+// providerFor returns the provider to use for a file, switched to the model
+// configured for its path, size or category if there is one. Path mappings
+// take precedence over routes, and routes over categories.
+func (a *Analyzer) providerFor(filename, category string, changedLines int) LLMProvider {
+	model := mostSpecificMatch(a.Config.AI.ModelByPath, filename)
+	if model == "" {
+		model = routeModel(a.Config.AI.ModelRoutes, filename, category, changedLines)
+	}
+	if model == "" {
+		model = a.Config.AI.ModelByCategory[category]
+	}
+	selectable, ok := a.Provider.(ModelSelectable)
+	if model == "" || !ok {
+		return a.Provider
+	}
+	fmt.Fprintf(progress, "  Using model %s for %s (%s)\n", model, filename, category)
+	return selectable.WithModel(model)
+}
+
+// rulesFor returns the rules document that applies to a file's location.
+// The rules of the nearest package config take precedence over rulesMap,
+// and its instructions are added to whichever rules apply.
+func (a *Analyzer) rulesFor(filename string) string {
+	rules := a.Rules
+	if path := rulesPathFor(a.Config.RulesMap, filename); path != "" {
+		rules = a.MappedRules[path]
+	}
+	pkg := a.packageFor(filename)
+	if pkg == nil {
+		return rules
+	}
+	if pkg.rules != "" {
+		rules = pkg.rules
+	}
+	if pkg.Instructions != "" {
+		rules += fmt.Sprintf("\n\nInstructions for the %s package:\n%s", pkg.dir, pkg.Instructions)
+	}
+	return rules
+}
+
+// lineNumberInstructions is added to the prompt when issues are placed on
+// lines of the diff, which only works if the model reports accurate lines.
+const lineNumberInstructions = `
+
+Each line of the code changes is prefixed with its line number in the new version of the file; removed lines have no number. Set "line" on every issue to the number of the line it is about, and leave it out only if the issue is not about a specific line.`
+
+// lineRangeInstructions asks for the last line of issues spanning several
+// lines, so comment.permalinks can link to the whole range.
+const lineRangeInstructions = `
+
+When an issue spans several lines, also set "endLine" to the number of the last of them.`
+
+// suggestedCodeInstructions asks for fixes that can be posted as GitHub
+// suggestions, which replace whole lines of the new file.
+const suggestedCodeInstructions = `
+
+When an issue has a concrete fix, set "suggestedCode" to the replacement for lines "line" through "endLine" of the new file (inclusive; leave out "endLine" for a single line). It replaces those lines completely, so include their full text with its original indentation and nothing else.`
+
+// buildPrompt fills the prompt template. The repository context, if any,
+// follows the rules so it reads as background to them rather than as rules
+// itself. When results are placed on lines, as inline comments or check
+// annotations, or linked with permalinks, the patch lines are numbered.
+func buildPrompt(patch string, config *Config, rules, repoContext string) string {
+	if repoContext != "" {
+		rules += "\n\nProject context:\n" + repoContext
+	}
+	numbered := false
+	if config.Comment.postsInline() || config.Check.Enabled || config.Comment.Permalinks || config.numberLines {
+		// Text without hunk headers, such as the docs pass sends, comes
+		// back unchanged and gets no line instructions.
+		original := patch
+		patch = numberPatchLines(patch)
+		numbered = patch != original
+	}
+	prompt := strings.Replace(config.AI.PromptTemplate, "{rules}", rules, 1)
+	prompt = strings.Replace(prompt, "{code}", patch, 1)
+	if numbered {
+		prompt += lineNumberInstructions
+		if config.Comment.postsInline() {
+			prompt += suggestedCodeInstructions
+		}
+		if config.Comment.Permalinks {
+			prompt += lineRangeInstructions
+		}
+	}
+	return prompt
+}
+
+// completeReport adds the results reused from an earlier run and the
+// findings of the heuristics, which look at every changed file, to the
+// analysis results, and then runs the post-process command over them.
+func completeReport(ctx context.Context, report *Report, config *Config, changedFiles []*ChangedFile, reused []*FileAnalysisResult) error {
+	heuristics, err := checkRequireTests(changedFiles, config.Heuristics.RequireTests)
+	if err != nil {
+		return fmt.Errorf("heuristics.requireTests: %w", err)
+	}
+	report.Results = aggregate(config, reused, report.Results, heuristics)
+	report.TotalFiles += len(reused)
+	for _, result := range reused {
+		report.Reused = append(report.Reused, result.Filename)
+	}
+
+	if config.PostProcessCommand != "" {
+		processed, err := runPostProcess(ctx, config.PostProcessCommand, report.Results)
+		if err != nil {
+			return fmt.Errorf("failed to post-process results: %w", err)
+		}
+		report.Results = aggregate(config, processed)
+	}
+	return nil
+}
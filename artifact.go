@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// resultsArtifactVersion is raised whenever a field of the results artifact
+// changes meaning or is removed, so tools reading it can tell formats apart.
+// New fields don't change the version.
+const resultsArtifactVersion = 1
+
+// ResultsArtifact is the machine-readable record of a run written to the
+// results-artifact input, for downstream tooling and for comparing runs.
+type ResultsArtifact struct {
+	Version     int    `json:"version"`
+	GeneratedAt string `json:"generatedAt"`
+	Repository  string `json:"repository"`
+	PullRequest int    `json:"pullRequest"`
+	Provider    string `json:"provider,omitempty"`
+	// Model is the provider's configured model. Empty means the
+	// provider's default, and files routed to other models by
+	// ai.modelRoutes and the like aren't distinguished.
+	Model string `json:"model,omitempty"`
+	// Usage is left out when no provider request reported its token
+	// counts, as with Cohere, Ollama, exec and combined matrix results.
+	Usage       *TokenUsage `json:"usage,omitempty"`
+	Interrupted bool        `json:"interrupted"`
+	Failed      []string    `json:"failed,omitempty"`
+	// TotalFiles, Analyzed and NotAnalyzed let mode post report a run cut
+	// short by the token budget.
+	TotalFiles  int                   `json:"totalFiles"`
+	Analyzed    []string              `json:"analyzed,omitempty"`
+	NotAnalyzed []string              `json:"notAnalyzed,omitempty"`
+	Files       []*FileAnalysisResult `json:"files"`
+}
+
+// newResultsArtifact records a run's results, with every issue's severity
+// resolved.
+func newResultsArtifact(report *Report, config *Config, prNumber int, provider LLMProvider) ResultsArtifact {
+	artifact := ResultsArtifact{
+		Version:     resultsArtifactVersion,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Repository:  os.Getenv("GITHUB_REPOSITORY"),
+		PullRequest: prNumber,
+		Provider:    config.AI.Provider,
+		Interrupted: report.Interrupted,
+		Failed:      report.Failed,
+		TotalFiles:  report.TotalFiles,
+		Analyzed:    report.Analyzed,
+		NotAnalyzed: report.NotAnalyzed,
+		Files:       make([]*FileAnalysisResult, 0, len(report.Results)),
+	}
+	if provider != nil {
+		artifact.Model = providerModel(provider)
+	}
+	if report.Usage.reported {
+		usage := report.Usage
+		artifact.Usage = &usage
+	}
+	for _, result := range report.Results {
+		file := *result
+		file.Issues = make([]Issue, len(result.Issues))
+		for i, issue := range result.Issues {
+			issue.Severity = issueSeverity(issue, config)
+			file.Issues[i] = issue
+		}
+		artifact.Files = append(artifact.Files, &file)
+	}
+	return artifact
+}
+
+// writeResultsArtifact writes the results artifact to path. An empty path
+// writes nothing.
+func writeResultsArtifact(path string, report *Report, config *Config, prNumber int, provider LLMProvider) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(newResultsArtifact(report, config, prNumber, provider), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// readResultsArtifact reads a results artifact written by
+// writeResultsArtifact.
+func readResultsArtifact(path string) (*ResultsArtifact, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var artifact ResultsArtifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, err
+	}
+	if artifact.Version != resultsArtifactVersion {
+		return nil, fmt.Errorf("unsupported version %d (want %d)", artifact.Version, resultsArtifactVersion)
+	}
+	if artifact.PullRequest == 0 {
+		return nil, fmt.Errorf("the results are not for a pull request")
+	}
+	return &artifact, nil
+}
+
+// report rebuilds the report of the run that wrote the artifact.
+func (a *ResultsArtifact) report() *Report {
+	return &Report{
+		Results:       a.Files,
+		Interrupted:   a.Interrupted,
+		Failed:        a.Failed,
+		TotalFiles:    a.TotalFiles,
+		Analyzed:      a.Analyzed,
+		BudgetReached: len(a.NotAnalyzed) > 0,
+		NotAnalyzed:   a.NotAnalyzed,
+	}
+}
+
+// providerModel returns the model a provider is configured with, or the
+// primary provider's for fallback chains and consensus.
+func providerModel(provider LLMProvider) string {
+	switch p := provider.(type) {
+	case *GeminiProvider:
+		return p.Config.Model
+	case *OpenAIProvider:
+		return p.Config.Model
+	case *AnthropicProvider:
+		return p.Config.Model
+	case *AzureOpenAIProvider:
+		return p.Config.Deployment
+	case *CohereProvider:
+		return p.Config.Model
+	case *OllamaProvider:
+		return p.Config.Model
+	case *OpenAICompatibleProvider:
+		return p.Config.Model
+	case *ExecProvider:
+		return p.Config.Model
+	case *FallbackProvider:
+		return providerModel(p.Chain[0].Provider)
+	case *ConsensusProvider:
+		return providerModel(p.Members[0].Provider)
+	}
+	return ""
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	azureDevOpsAPIVersion = "7.0"
+	// maxDiffCells bounds the size of the line table unifiedDiff builds for
+	// a file, whose old and new versions Azure DevOps returns instead of a
+	// patch. Larger files are skipped.
+	maxDiffCells = 25_000_000
+)
+
+// runAzureDevOps analyzes an Azure Repos pull request and reports on it with
+// comment threads. The organization, project, repository and pull request
+// default to the predefined variables of an Azure Pipelines pull request
+// build. The config and rules are read from the checkout. It returns the
+// process exit code.
+func runAzureDevOps(args []string) int {
+	cmd := newSubcommand("azure-devops")
+	organization := cmd.String("organization", os.Getenv("SYSTEM_COLLECTIONURI"), "organization URL, e.g. https://dev.azure.com/contoso")
+	project := cmd.String("project", os.Getenv("SYSTEM_TEAMPROJECT"), "project name")
+	repository := cmd.String("repository", os.Getenv("BUILD_REPOSITORY_NAME"), "repository name or ID")
+	pullRequest := cmd.String("pull-request", os.Getenv("SYSTEM_PULLREQUEST_PULLREQUESTID"), "pull request ID")
+	return cmd.review(args, func() (ReviewHost, error) {
+		return newAzureDevOpsHost(*organization, *project, *repository, *pullRequest, os.Getenv("SEMANTIC_LINT_AZURE_DEVOPS_TOKEN"))
+	})
+}
+
+// azureDevOpsHost is an Azure Repos pull request, reached through the REST
+// API with a personal access token.
+type azureDevOpsHost struct {
+	client *http.Client
+	// repo is the API URL of the repository and pr the pull request's path
+	// below it.
+	repo  string
+	pr    string
+	token string
+
+	existing map[string]bool
+}
+
+// newAzureDevOpsHost checks the pull request's coordinates. The token is a
+// personal access token with the Code (read and write) scope.
+func newAzureDevOpsHost(organization, project, repository, pullRequest, token string) (*azureDevOpsHost, error) {
+	switch {
+	case organization == "" || project == "" || repository == "":
+		return nil, fmt.Errorf("-organization, -project and -repository are required outside Azure Pipelines")
+	case pullRequest == "":
+		return nil, fmt.Errorf("-pull-request is required outside a pull request build")
+	case token == "":
+		return nil, fmt.Errorf("SEMANTIC_LINT_AZURE_DEVOPS_TOKEN is not set")
+	}
+	return &azureDevOpsHost{
+		client: http.DefaultClient,
+		repo:   fmt.Sprintf("%s/%s/_apis/git/repositories/%s", strings.TrimSuffix(organization, "/"), url.PathEscape(project), url.PathEscape(repository)),
+		pr:     "/pullRequests/" + pullRequest,
+		token:  token,
+	}, nil
+}
+
+// do sends a request to a path below the repository's API URL and decodes
+// the JSON response into out, unless out is nil. The raw response body is
+// returned too, for blob contents.
+func (h *azureDevOpsHost) do(ctx context.Context, method, path string, body, out any) ([]byte, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	data, _, err := hostRequest(ctx, h.client, method, h.repo+path+separator+"api-version="+azureDevOpsAPIVersion, body, func(req *http.Request) {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+h.token)))
+	})
+	if err != nil || out == nil {
+		return data, err
+	}
+	return data, json.Unmarshal(data, out)
+}
+
+type azureDevOpsChange struct {
+	ChangeType string `json:"changeType"`
+	Item       struct {
+		Path             string `json:"path"`
+		ObjectID         string `json:"objectId"`
+		OriginalObjectID string `json:"originalObjectId"`
+		IsFolder         bool   `json:"isFolder"`
+	} `json:"item"`
+}
+
+// ChangedFiles lists the changes of the pull request's latest iteration.
+// Azure DevOps has no patches, so each file's patch is the diff between
+// the blobs of its old and new versions. Binary files and files too large
+// to diff are left out.
+func (h *azureDevOpsHost) ChangedFiles(ctx context.Context) ([]*ChangedFile, error) {
+	var iterations struct {
+		Value []struct {
+			ID int `json:"id"`
+		} `json:"value"`
+	}
+	if _, err := h.do(ctx, http.MethodGet, h.pr+"/iterations", nil, &iterations); err != nil {
+		return nil, fmt.Errorf("failed to list pull request iterations: %w", err)
+	}
+	if len(iterations.Value) == 0 {
+		return nil, nil
+	}
+	latest := iterations.Value[len(iterations.Value)-1].ID
+
+	var changes []azureDevOpsChange
+	for skip := 0; ; {
+		var page struct {
+			ChangeEntries []azureDevOpsChange `json:"changeEntries"`
+			NextSkip      int                 `json:"nextSkip"`
+		}
+		if _, err := h.do(ctx, http.MethodGet, fmt.Sprintf("%s/iterations/%d/changes?$top=2000&$skip=%d", h.pr, latest, skip), nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to list pull request changes: %w", err)
+		}
+		changes = append(changes, page.ChangeEntries...)
+		if page.NextSkip == 0 {
+			break
+		}
+		skip = page.NextSkip
+	}
+
+	var files []*ChangedFile
+	for _, change := range changes {
+		if change.Item.IsFolder || strings.Contains(change.ChangeType, "delete") {
+			continue
+		}
+		file := &ChangedFile{Filename: strings.TrimPrefix(change.Item.Path, "/"), SHA: change.Item.ObjectID, Status: "modified"}
+		newText, err := h.blob(ctx, change.Item.ObjectID)
+		if err != nil {
+			return nil, err
+		}
+		oldText := ""
+		if change.Item.OriginalObjectID != "" {
+			if oldText, err = h.blob(ctx, change.Item.OriginalObjectID); err != nil {
+				return nil, err
+			}
+		}
+		if strings.IndexByte(newText, 0) >= 0 || strings.IndexByte(oldText, 0) >= 0 {
+			continue
+		}
+
+		newLines := strings.Split(strings.TrimSuffix(newText, "\n"), "\n")
+		switch {
+		case change.Item.OriginalObjectID == "":
+			file.Status = "added"
+			file.Patch = additionPatch(newLines, 1)
+		case strings.Count(oldText, "\n")*len(newLines) > maxDiffCells:
+			fmt.Printf("Skipping %s: too large to diff.\n", file.Filename)
+			continue
+		default:
+			if strings.Contains(change.ChangeType, "rename") {
+				file.Status = "renamed"
+			}
+			diff := unifiedDiff("a/"+file.Filename, "b/"+file.Filename, strings.TrimSuffix(oldText, "\n"), strings.TrimSuffix(newText, "\n"))
+			_, file.Patch, _ = strings.Cut(diff, "\n+++ b/"+file.Filename+"\n")
+			file.Patch = strings.TrimSuffix(file.Patch, "\n")
+		}
+		if file.Patch != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (h *azureDevOpsHost) blob(ctx context.Context, objectID string) (string, error) {
+	data, err := h.do(ctx, http.MethodGet, "/blobs/"+objectID+"?$format=octetstream", nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get blob %s: %w", objectID, err)
+	}
+	return string(data), nil
+}
+
+// AddedLines returns the added and context lines of each file. A thread is
+// placed on a line of the right side of the diff by its line number alone.
+func (h *azureDevOpsHost) AddedLines(files []*ChangedFile) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool, len(files))
+	for _, file := range files {
+		lines[file.Filename] = commentableLines(file.Patch)
+	}
+	return lines
+}
+
+type azureDevOpsPosition struct {
+	Line   int `json:"line"`
+	Offset int `json:"offset"`
+}
+
+type azureDevOpsThread struct {
+	ID            int    `json:"id,omitempty"`
+	Status        string `json:"status,omitempty"`
+	IsDeleted     bool   `json:"isDeleted,omitempty"`
+	ThreadContext *struct {
+		FilePath       string               `json:"filePath"`
+		RightFileStart *azureDevOpsPosition `json:"rightFileStart,omitempty"`
+		RightFileEnd   *azureDevOpsPosition `json:"rightFileEnd,omitempty"`
+	} `json:"threadContext,omitempty"`
+	Comments []struct {
+		ID      int    `json:"id,omitempty"`
+		Content string `json:"content"`
+	} `json:"comments"`
+}
+
+func (h *azureDevOpsHost) threads(ctx context.Context) ([]azureDevOpsThread, error) {
+	var threads struct {
+		Value []azureDevOpsThread `json:"value"`
+	}
+	if _, err := h.do(ctx, http.MethodGet, h.pr+"/threads", nil, &threads); err != nil {
+		return nil, fmt.Errorf("failed to list pull request threads: %w", err)
+	}
+	return threads.Value, nil
+}
+
+// PostLineComment opens an active thread on a line of the new version of a
+// file. The existing threads are fetched with the first one.
+func (h *azureDevOpsHost) PostLineComment(ctx context.Context, comment LineComment) error {
+	filename, line, body := comment.Filename, comment.Issue.Line, stripHiddenData(comment.Body)
+	if h.existing == nil {
+		threads, err := h.threads(ctx)
+		if err != nil {
+			return err
+		}
+		h.existing = make(map[string]bool)
+		for _, thread := range threads {
+			where := thread.ThreadContext
+			if thread.IsDeleted || where == nil || where.RightFileStart == nil || len(thread.Comments) == 0 {
+				continue
+			}
+			h.existing[lineCommentKey(strings.TrimPrefix(where.FilePath, "/"), where.RightFileStart.Line, thread.Comments[0].Content)] = true
+		}
+	}
+	if h.existing[lineCommentKey(filename, line, body)] {
+		return nil
+	}
+
+	thread := map[string]any{
+		"status":   "active",
+		"comments": []map[string]any{{"parentCommentId": 0, "content": body, "commentType": "text"}},
+		"threadContext": map[string]any{
+			"filePath":       "/" + filename,
+			"rightFileStart": azureDevOpsPosition{Line: line, Offset: 1},
+			"rightFileEnd":   azureDevOpsPosition{Line: line, Offset: 1},
+		},
+	}
+	if _, err := h.do(ctx, http.MethodPost, h.pr+"/threads", thread, nil); err != nil {
+		return fmt.Errorf("failed to comment on %s:%d: %w", filename, line, err)
+	}
+	h.existing[lineCommentKey(filename, line, body)] = true
+	return nil
+}
+
+// PostSummary edits the first comment of the summary thread an earlier run
+// opened, found by its heading, or opens one. The thread is active while
+// there are issues and closed once the run is clean.
+func (h *azureDevOpsHost) PostSummary(ctx context.Context, body string, clean bool) error {
+	if body == "" {
+		return nil
+	}
+	body = stripHiddenData(body)
+	status := "active"
+	if clean {
+		status = "closed"
+	}
+	threads, err := h.threads(ctx)
+	if err != nil {
+		return err
+	}
+	for _, thread := range threads {
+		if thread.IsDeleted || thread.ThreadContext != nil || len(thread.Comments) == 0 || !strings.HasPrefix(thread.Comments[0].Content, summaryHeading) {
+			continue
+		}
+		comment := fmt.Sprintf("%s/threads/%d/comments/%d", h.pr, thread.ID, thread.Comments[0].ID)
+		if _, err := h.do(ctx, http.MethodPatch, comment, map[string]string{"content": body}, nil); err != nil {
+			return err
+		}
+		_, err := h.do(ctx, http.MethodPatch, fmt.Sprintf("%s/threads/%d", h.pr, thread.ID), map[string]string{"status": status}, nil)
+		return err
+	}
+	thread := map[string]any{
+		"status":   status,
+		"comments": []map[string]any{{"parentCommentId": 0, "content": body, "commentType": "text"}},
+	}
+	_, err = h.do(ctx, http.MethodPost, h.pr+"/threads", thread, nil)
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AzureOpenAIConfig configures an Azure OpenAI deployment. Azure serves the
+// OpenAI chat completions API under a per-resource endpoint, with the model
+// picked by deployment name rather than in the request.
+type AzureOpenAIConfig struct {
+	// Endpoint is the resource URL, e.g. https://my-resource.openai.azure.com.
+	Endpoint   string `json:"endpoint"`
+	Deployment string `json:"deployment"`
+	// APIVersion defaults to defaultAzureOpenAIAPIVersion.
+	APIVersion string            `json:"apiVersion"`
+	Headers    map[string]string `json:"headers"`
+	Generation GenerationParams  `json:"generation"`
+}
+
+const defaultAzureOpenAIAPIVersion = "2024-06-01"
+
+type AzureOpenAIProvider struct {
+	Config          AzureOpenAIConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+	Stream          bool
+}
+
+func (p *AzureOpenAIProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	if p.Config.Endpoint == "" || p.Config.Deployment == "" {
+		return nil, fmt.Errorf("ai.azureOpenAI.endpoint and ai.azureOpenAI.deployment are required")
+	}
+	version := p.Config.APIVersion
+	if version == "" {
+		version = defaultAzureOpenAIAPIVersion
+	}
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimSuffix(p.Config.Endpoint, "/"), url.PathEscape(p.Config.Deployment), url.QueryEscape(version))
+
+	// Azure authenticates with an api-key header instead of a bearer token.
+	headers := map[string]string{"Authorization": "", "api-key": "{{AI_API_KEY}}"}
+	for key, value := range p.Config.Headers {
+		headers[key] = value
+	}
+	openAI := &OpenAIProvider{
+		Config:          OpenAIConfig{APIEndpoint: endpoint, Model: p.Config.Deployment, Headers: headers, Generation: p.Config.Generation},
+		MaxOutputTokens: p.MaxOutputTokens,
+		HTTPClient:      p.HTTPClient,
+		Stream:          p.Stream,
+	}
+	return openAI.Analyze(ctx, patch, prompt, apiKey)
+}
+
+// WithModel switches the deployment, which is how Azure selects a model.
+func (p *AzureOpenAIProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Deployment = model
+	return &clone
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const bitbucketAPI = "https://api.bitbucket.org/2.0"
+
+// runBitbucket analyzes the pull request of a Bitbucket Pipelines pull
+// request pipeline and reports on it with comments. The config and rules
+// are read from the checkout. It returns the process exit code.
+func runBitbucket(args []string) int {
+	return newSubcommand("bitbucket").review(args, func() (ReviewHost, error) {
+		return bitbucketHostFromEnv()
+	})
+}
+
+// bitbucketHost is a Bitbucket Cloud pull request, reached through the REST
+// API.
+type bitbucketHost struct {
+	client  *http.Client
+	baseURL string
+	// user is set for an app password, which is sent with basic auth.
+	// Otherwise token is an access token sent as a bearer token.
+	user  string
+	token string
+	pr    string
+
+	existing map[string]bool
+}
+
+// bitbucketHostFromEnv reads the pull request from the default variables of
+// a pull request pipeline. The API token comes from
+// SEMANTIC_LINT_BITBUCKET_TOKEN: a repository access token with the pull
+// request write scope, or an app password together with
+// SEMANTIC_LINT_BITBUCKET_USER.
+func bitbucketHostFromEnv() (*bitbucketHost, error) {
+	workspace, slug, id := os.Getenv("BITBUCKET_WORKSPACE"), os.Getenv("BITBUCKET_REPO_SLUG"), os.Getenv("BITBUCKET_PR_ID")
+	host := &bitbucketHost{
+		client:  http.DefaultClient,
+		baseURL: bitbucketAPI,
+		user:    os.Getenv("SEMANTIC_LINT_BITBUCKET_USER"),
+		token:   os.Getenv("SEMANTIC_LINT_BITBUCKET_TOKEN"),
+		pr:      fmt.Sprintf("/repositories/%s/%s/pullrequests/%s", workspace, slug, id),
+	}
+	switch {
+	case workspace == "" || slug == "":
+		return nil, fmt.Errorf("BITBUCKET_WORKSPACE and BITBUCKET_REPO_SLUG are not set; run in Bitbucket Pipelines")
+	case id == "":
+		return nil, fmt.Errorf("BITBUCKET_PR_ID is not set; run in a pull request pipeline")
+	case host.token == "":
+		return nil, fmt.Errorf("SEMANTIC_LINT_BITBUCKET_TOKEN is not set")
+	}
+	return host, nil
+}
+
+// do sends a request to the API. url is a path below the API root or, for
+// the next page of a list, the absolute URL the API returned. The response
+// body is returned for the caller to decode.
+func (h *bitbucketHost) do(ctx context.Context, method, url string, body any) ([]byte, error) {
+	if strings.HasPrefix(url, "/") {
+		url = h.baseURL + url
+	}
+	data, _, err := hostRequest(ctx, h.client, method, url, body, func(req *http.Request) {
+		if h.user != "" {
+			req.SetBasicAuth(h.user, h.token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+h.token)
+		}
+	})
+	return data, err
+}
+
+// bitbucketList fetches every page of a list endpoint by following its
+// next links.
+func bitbucketList[T any](ctx context.Context, h *bitbucketHost, url string) ([]T, error) {
+	var all []T
+	for url != "" {
+		data, err := h.do(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Values []T    `json:"values"`
+			Next   string `json:"next"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Values...)
+		url = page.Next
+	}
+	return all, nil
+}
+
+type bitbucketDiffStat struct {
+	Status string `json:"status"`
+	Old    *struct {
+		Path string `json:"path"`
+	} `json:"old"`
+	New *struct {
+		Path string `json:"path"`
+	} `json:"new"`
+}
+
+// ChangedFiles lists the changed files from the pull request's diffstat and
+// takes their patches from its diff. Files without hunks in the diff, such
+// as binary files, are left out.
+func (h *bitbucketHost) ChangedFiles(ctx context.Context) ([]*ChangedFile, error) {
+	stats, err := bitbucketList[bitbucketDiffStat](ctx, h, h.pr+"/diffstat")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request diffstat: %w", err)
+	}
+	diff, err := h.do(ctx, http.MethodGet, h.pr+"/diff", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request diff: %w", err)
+	}
+	patches := make(map[string]string)
+	for _, file := range parseGitDiff(string(diff)) {
+		patches[file.Filename] = file.Patch
+	}
+
+	var files []*ChangedFile
+	for _, stat := range stats {
+		file := &ChangedFile{Status: stat.Status}
+		switch {
+		case stat.New != nil:
+			file.Filename = stat.New.Path
+		case stat.Old != nil:
+			file.Filename = stat.Old.Path
+		}
+		// Bitbucket's statuses match GitHub's apart from this one.
+		if file.Status == "merge conflict" {
+			file.Status = "modified"
+		}
+		if file.Patch = patches[file.Filename]; file.Patch != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// AddedLines returns the added and context lines of each file, all of which
+// Bitbucket places a comment on by their new line number.
+func (h *bitbucketHost) AddedLines(files []*ChangedFile) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool, len(files))
+	for _, file := range files {
+		lines[file.Filename] = commentableLines(file.Patch)
+	}
+	return lines
+}
+
+type bitbucketComment struct {
+	ID      int64 `json:"id"`
+	Deleted bool  `json:"deleted"`
+	Content struct {
+		Raw string `json:"raw"`
+	} `json:"content"`
+	Inline *struct {
+		Path string `json:"path"`
+		To   int    `json:"to"`
+	} `json:"inline"`
+}
+
+func (h *bitbucketHost) comments(ctx context.Context) ([]bitbucketComment, error) {
+	comments, err := bitbucketList[bitbucketComment](ctx, h, h.pr+"/comments?pagelen=100")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull request comments: %w", err)
+	}
+	return comments, nil
+}
+
+// PostLineComment comments on a line of the new version of a file. The
+// existing comments are fetched with the first one.
+func (h *bitbucketHost) PostLineComment(ctx context.Context, comment LineComment) error {
+	filename, line, body := comment.Filename, comment.Issue.Line, stripHiddenData(comment.Body)
+	if h.existing == nil {
+		comments, err := h.comments(ctx)
+		if err != nil {
+			return err
+		}
+		h.existing = make(map[string]bool)
+		for _, existing := range comments {
+			if existing.Inline != nil && !existing.Deleted {
+				h.existing[lineCommentKey(existing.Inline.Path, existing.Inline.To, existing.Content.Raw)] = true
+			}
+		}
+	}
+	if h.existing[lineCommentKey(filename, line, body)] {
+		return nil
+	}
+
+	request := map[string]any{
+		"content": map[string]string{"raw": body},
+		"inline":  map[string]any{"path": filename, "to": line},
+	}
+	if _, err := h.do(ctx, http.MethodPost, h.pr+"/comments", request); err != nil {
+		return fmt.Errorf("failed to comment on %s:%d: %w", filename, line, err)
+	}
+	h.existing[lineCommentKey(filename, line, body)] = true
+	return nil
+}
+
+// PostSummary edits the comment an earlier run left, found by the summary
+// heading, or adds one.
+func (h *bitbucketHost) PostSummary(ctx context.Context, body string, clean bool) error {
+	if body == "" {
+		return nil
+	}
+	body = stripHiddenData(body)
+	comments, err := h.comments(ctx)
+	if err != nil {
+		return err
+	}
+	comment := map[string]any{"content": map[string]string{"raw": body}}
+	for _, existing := range comments {
+		if existing.Inline == nil && !existing.Deleted && strings.HasPrefix(existing.Content.Raw, summaryHeading) {
+			_, err := h.do(ctx, http.MethodPut, fmt.Sprintf("%s/comments/%d", h.pr, existing.ID), comment)
+			return err
+		}
+	}
+	_, err = h.do(ctx, http.MethodPost, h.pr+"/comments", comment)
+	return err
+}
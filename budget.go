@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BudgetConfig bounds how many prompt tokens a run may spend. Files are
+// analyzed in order until the next prompt would exceed the budget.
+type BudgetConfig struct {
+	MaxTokens int `json:"maxTokens"`
+	// Banner is shown when the budget stops analysis early. {analyzed} and
+	// {total} are replaced with file counts.
+	Banner string `json:"banner"`
+}
+
+const defaultBudgetBanner = "Budget reached: {analyzed} of {total} files analyzed. Files that were not analyzed have not been checked and may still contain issues."
+
+// estimateTokens approximates the token count of a prompt at four characters
+// per token, which is close enough for English text and source code.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// renderBudgetBanner renders the budget notice with the files this run
+// analyzed, those reused from the previous run, those the provider failed
+// on and those the budget left out.
+func renderBudgetBanner(report *Report, config *Config) string {
+	banner := config.Budget.Banner
+	if banner == "" {
+		banner = defaultBudgetBanner
+	}
+	banner = strings.ReplaceAll(banner, "{analyzed}", strconv.Itoa(len(report.Analyzed)))
+	banner = strings.ReplaceAll(banner, "{total}", strconv.Itoa(report.TotalFiles))
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("> 💸 %s\n\n", banner))
+	out.WriteString("<details><summary>Files</summary>\n\n")
+	for _, group := range []struct {
+		title     string
+		filenames []string
+	}{
+		{"Analyzed", report.Analyzed},
+		{"Reused from the previous run", report.Reused},
+		{"Failed", report.Failed},
+		{"Not analyzed", report.NotAnalyzed},
+	} {
+		if len(group.filenames) == 0 {
+			continue
+		}
+		out.WriteString(group.title + ":\n\n")
+		for _, filename := range group.filenames {
+			out.WriteString(fmt.Sprintf("- `%s`\n", filename))
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("</details>\n\n")
+	return out.String()
+}
+
+// writeStepSummary appends Markdown to the job summary of the current
+// workflow run. It is a no-op outside of GitHub Actions.
+func writeStepSummary(markdown string) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(markdown)
+	return err
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// CheckConfig controls the check run created on the pull request head.
+type CheckConfig struct {
+	Enabled bool `json:"enabled"`
+	// Name of the check run. Defaults to "Semantic Linting".
+	Name string `json:"name"`
+	// Conclusions maps "error", "warning" and "clean" to the conclusion the
+	// check run reports for a run whose worst finding is of that tier, and
+	// "incomplete" to the one for a run without findings that didn't
+	// analyze every file. It only affects the check, not the action's exit
+	// code.
+	Conclusions map[string]string `json:"conclusions"`
+}
+
+var defaultCheckConclusions = map[string]string{
+	"error":      "failure",
+	"warning":    "neutral",
+	"incomplete": "neutral",
+	"clean":      "success",
+}
+
+// successWithAnnotations is a check conclusion of its own in the config:
+// the check succeeds and the issues are still annotated, but as notices, so
+// a required check passes without marking lines as failures.
+const successWithAnnotations = "success-with-annotations"
+
+var validCheckConclusions = map[string]bool{
+	"success":              true,
+	"neutral":              true,
+	"failure":              true,
+	"action_required":      true,
+	successWithAnnotations: true,
+}
+
+// validateCheckConclusions rejects unknown tiers and conclusions.
+func validateCheckConclusions(conclusions map[string]string) error {
+	for tier, conclusion := range conclusions {
+		if _, ok := defaultCheckConclusions[tier]; !ok {
+			return fmt.Errorf("unknown tier %q (want error, warning, incomplete or clean)", tier)
+		}
+		if !validCheckConclusions[conclusion] {
+			return fmt.Errorf("unsupported conclusion %q for %s (want success, success-with-annotations, neutral, failure or action_required)", conclusion, tier)
+		}
+	}
+	return nil
+}
+
+// checkConclusion picks the conclusion for the worst severity found. A run
+// without findings is only clean when it analyzed every file.
+func checkConclusion(errors, warnings int, complete bool, config *Config) string {
+	tier := "clean"
+	switch {
+	case errors > 0:
+		tier = "error"
+	case warnings > 0:
+		tier = "warning"
+	case !complete:
+		tier = "incomplete"
+	}
+	if conclusion, ok := config.Check.Conclusions[tier]; ok {
+		return conclusion
+	}
+	return defaultCheckConclusions[tier]
+}
+
+const (
+	defaultCheckName = "Semantic Linting"
+	// maxCheckOutputLength is GitHub's limit on each of a check run's
+	// summary and text.
+	maxCheckOutputLength = 65535
+	// maxAnnotationsPerRequest is how many annotations GitHub accepts in
+	// one create or update call; more are added in further updates.
+	maxAnnotationsPerRequest = 50
+	// maxAnnotationMessageLength is GitHub's limit on an annotation's
+	// message.
+	maxAnnotationMessageLength = 64 * 1024
+)
+
+// checkAnnotations turns every issue into an annotation on its file. Issues
+// without a line are placed on the first line. With asNotices every
+// annotation is a notice, whatever the issue's severity.
+func checkAnnotations(results []*FileAnalysisResult, config *Config, asNotices bool) []*github.CheckRunAnnotation {
+	var annotations []*github.CheckRunAnnotation
+	for _, result := range fileResults(results) {
+		for _, issue := range result.Issues {
+			start := issue.Line
+			if start <= 0 {
+				start = 1
+			}
+			end := start
+			if issue.EndLine > start {
+				end = issue.EndLine
+			}
+			level := "warning"
+			switch {
+			case asNotices:
+				level = "notice"
+			case issueSeverity(issue, config) == "error":
+				level = "failure"
+			}
+			message := issue.Message
+			if issue.Suggestion != "" {
+				message += "\n\nSuggestion: " + issue.Suggestion
+			}
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            github.String(result.Filename),
+				StartLine:       github.Int(start),
+				EndLine:         github.Int(end),
+				AnnotationLevel: github.String(level),
+				Title:           github.String(issue.Type),
+				Message:         github.String(truncate(message, maxAnnotationMessageLength)),
+			})
+		}
+	}
+	return annotations
+}
+
+// createCheckRun reports the results as a completed check run. Its summary
+// holds the per-file severity table and its text the full details, so the
+// checks tab is useful even when comments are disabled. Every issue is also
+// attached as an annotation, which shows it in the Files Changed tab.
+func createCheckRun(ctx context.Context, client *github.Client, owner, repo string, prNumber int, headSHA string, report *Report, config *Config) error {
+	name := config.Check.Name
+	if name == "" {
+		name = defaultCheckName
+	}
+
+	errors, warnings := countSeverities(report.Results, config)
+	conclusion := checkConclusion(errors, warnings, report.complete(), config)
+
+	title := fmt.Sprintf("%d error(s), %d warning(s)", errors, warnings)
+	if report.Score != nil {
+		title = fmt.Sprintf("Score %d/100: %s", *report.Score, title)
+	}
+
+	summary := renderNotices(report, config) + renderSummaryTable(report.Results, config)
+	if summary == "" {
+		summary = "No issues found."
+	}
+
+	output := func(annotations []*github.CheckRunAnnotation) *github.CheckRunOutput {
+		return &github.CheckRunOutput{
+			Title:       github.String(title),
+			Summary:     github.String(truncate(summary, maxCheckOutputLength)),
+			Text:        github.String(truncate(renderDetails(report, config), maxCheckOutputLength)),
+			Annotations: annotations,
+		}
+	}
+	annotations := checkAnnotations(report.Results, config, conclusion == successWithAnnotations)
+	if conclusion == successWithAnnotations {
+		conclusion = "success"
+	}
+	first := annotations[:min(len(annotations), maxAnnotationsPerRequest)]
+
+	opts := github.CreateCheckRunOptions{
+		Name:       name,
+		HeadSHA:    headSHA,
+		Status:     github.String("completed"),
+		Conclusion: github.String(conclusion),
+		Output:     output(first),
+	}
+	if conclusion == "action_required" {
+		// GitHub requires a details URL for action_required.
+		if prNumber > 0 {
+			opts.DetailsURL = github.String(fmt.Sprintf("%s/%s/%s/pull/%d", serverURL(), owner, repo, prNumber))
+		} else {
+			opts.DetailsURL = github.String(fmt.Sprintf("%s/%s/%s/commit/%s", serverURL(), owner, repo, headSHA))
+		}
+	}
+	run, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, opts)
+	if err != nil {
+		return err
+	}
+
+	for rest := annotations[len(first):]; len(rest) > 0; {
+		batch := rest[:min(len(rest), maxAnnotationsPerRequest)]
+		rest = rest[len(batch):]
+		update := github.UpdateCheckRunOptions{Name: name, Output: output(batch)}
+		if _, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, run.GetID(), update); err != nil {
+			return fmt.Errorf("failed to add annotations: %w", err)
+		}
+	}
+	return nil
+}
+
+func countSeverities(results []*FileAnalysisResult, config *Config) (errors, warnings int) {
+	for _, result := range results {
+		for _, issue := range result.Issues {
+			if issueSeverity(issue, config) == "error" {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+	}
+	return errors, warnings
+}
+
+// serverURL is the base URL of the GitHub instance the workflow reports
+// to: the one the api-url input points at, or the one it runs on.
+func serverURL() string {
+	if apiURL := os.Getenv("INPUT_API-URL"); apiURL != "" {
+		return strings.TrimSuffix(strings.TrimSuffix(apiURL, "/"), "/api/v3")
+	}
+	if url := os.Getenv("GITHUB_SERVER_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "https://github.com"
+}
+
+// truncate shortens s to at most limit bytes, marking the cut.
+func truncate(s string, limit int) string {
+	const marker = "\n\n… (truncated)"
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit - len(marker)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + marker
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const (
+	// maxCommentLength is GitHub's limit on the body of a comment or
+	// review.
+	maxCommentLength = 65536
+	// continuationMarkerPrefix starts each extra comment a summary too long
+	// for one comment continues in, followed by the part's number.
+	continuationMarkerPrefix = "<!-- semantic-lint:continued="
+	continuedFooter          = "\n_Continued in the next comment._\n"
+)
+
+func continuationMarker(part int) string {
+	return fmt.Sprintf("%s%d -->", continuationMarkerPrefix, part)
+}
+
+// splitComment splits body at line breaks into parts of at most limit
+// bytes. A single line longer than limit is truncated.
+func splitComment(body string, limit int) []string {
+	var parts []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if len(line) > limit {
+			line = truncate(line, limit)
+		}
+		if current.Len()+len(line) > limit {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// renderSummaryParts renders the summary comment, split over as many
+// comments as GitHub's length limit requires. The first part carries the
+// summary marker and the hidden state, so later runs find it as before.
+// State too large to fit is left out, which only means the next run
+// analyzes every file again.
+func renderSummaryParts(report *Report, config *Config) ([]string, error) {
+	state, err := encodeHiddenData("state", report.Results)
+	if err != nil {
+		return nil, err
+	}
+	body := renderComment(report, config)
+	if len(summaryMarker)+len(body)+len(state)+2 <= maxCommentLength {
+		return []string{summaryMarker + "\n" + body + state + "\n"}, nil
+	}
+
+	if len(state) > maxCommentLength/2 {
+		fmt.Println("::warning::The results are too large to store for reuse by the next run.")
+		state = ""
+	}
+	// Leave room for the markers, the footer and, in the first part, the
+	// state.
+	overhead := len(continuationMarker(999)) + len(continuedFooter) + 2
+	parts := splitComment(body, maxCommentLength-overhead-len(state))
+	for i := range parts {
+		if i < len(parts)-1 {
+			parts[i] += continuedFooter
+		}
+		if i == 0 {
+			parts[i] = summaryMarker + "\n" + parts[i] + state + "\n"
+		} else {
+			parts[i] = continuationMarker(i+1) + "\n" + parts[i]
+		}
+	}
+	return parts, nil
+}
+
+// postContinuations posts the continuation parts of a summary comment,
+// editing the continuation comments of an earlier run in place when
+// comment.update is "update" and removing those no longer needed.
+// Otherwise new comments are posted, and with "recreate" the earlier ones
+// are deleted first.
+func postContinuations(ctx context.Context, client *github.Client, owner, repo string, prNumber int, parts []string, config *Config) error {
+	var existing []*github.IssueComment
+	if config.Comment.update() != commentUpdateAppend {
+		comments, err := listOwnIssueComments(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			return fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if strings.HasPrefix(c.GetBody(), continuationMarkerPrefix) {
+				existing = append(existing, c)
+			}
+		}
+	}
+	if config.Comment.update() == commentUpdateRecreate {
+		if err := deleteComments(ctx, client, owner, repo, existing); err != nil {
+			return err
+		}
+		existing = nil
+	}
+
+	for i, part := range parts {
+		body := part
+		if i < len(existing) {
+			if _, _, err := client.Issues.EditComment(ctx, owner, repo, existing[i].GetID(), &github.IssueComment{Body: &body}); err != nil {
+				return fmt.Errorf("failed to update continuation comment: %w", err)
+			}
+			continue
+		}
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: &body}); err != nil {
+			return fmt.Errorf("failed to post continuation comment: %w", err)
+		}
+	}
+	if len(existing) > len(parts) {
+		return deleteComments(ctx, client, owner, repo, existing[len(parts):])
+	}
+	return nil
+}
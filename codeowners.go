@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// codeownersPaths are the locations GitHub reads CODEOWNERS from, in the
+// order it looks for them.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is one line of a CODEOWNERS file.
+type codeownersRule struct {
+	// globs are doublestar patterns equivalent to the line's pattern.
+	globs  []string
+	owners []string
+}
+
+// loadCodeowners reads and parses the first CODEOWNERS file found.
+func loadCodeowners(readFile fileReader) ([]codeownersRule, error) {
+	for _, path := range codeownersPaths {
+		content, err := readFile(path)
+		if err != nil {
+			continue
+		}
+		return parseCodeowners(content), nil
+	}
+	return nil, fmt.Errorf("no CODEOWNERS file found in %s", strings.Join(codeownersPaths, ", "))
+}
+
+func parseCodeowners(content string) []codeownersRule {
+	var rules []codeownersRule
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rules = append(rules, codeownersRule{globs: codeownersGlobs(fields[0]), owners: fields[1:]})
+	}
+	return rules
+}
+
+// codeownersGlobs translates a CODEOWNERS pattern, which follows gitignore
+// rules, to doublestar globs: a pattern without a slash matches at any
+// depth, a leading slash anchors it to the root, and a pattern naming a
+// directory matches everything below it.
+func codeownersGlobs(pattern string) []string {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !anchored && !strings.HasPrefix(pattern, "**/") {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return []string{pattern + "**"}
+	}
+	return []string{pattern, pattern + "/**"}
+}
+
+// ownersOf returns the owners of a file. As on GitHub, the last matching
+// line wins.
+func ownersOf(rules []codeownersRule, filename string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if match, _ := matchAny(filename, rules[i].globs); match {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// filterOwnedFiles keeps the files owned by owner, compared without regard
+// to case or a leading "@".
+func filterOwnedFiles(files []*ChangedFile, rules []codeownersRule, owner string) []*ChangedFile {
+	normalize := func(o string) string { return strings.ToLower(strings.TrimPrefix(o, "@")) }
+	want := normalize(owner)
+	var kept []*ChangedFile
+	for _, file := range files {
+		for _, o := range ownersOf(rules, file.Filename) {
+			if normalize(o) == want {
+				kept = append(kept, file)
+				break
+			}
+		}
+	}
+	fmt.Printf("Ownership by %s filtered out %d of %d file(s).\n", owner, len(files)-len(kept), len(files))
+	return kept
+}
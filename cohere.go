@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CohereConfig configures Cohere's Command models through the v2 Chat API.
+type CohereConfig struct {
+	// APIEndpoint defaults to https://api.cohere.com/v2/chat.
+	APIEndpoint string            `json:"apiEndpoint"`
+	Model       string            `json:"model"`
+	Headers     map[string]string `json:"headers"`
+	Generation  GenerationParams  `json:"generation"`
+}
+
+const (
+	defaultCohereEndpoint = "https://api.cohere.com/v2/chat"
+	defaultCohereModel    = "command-r-plus"
+)
+
+type CohereProvider struct {
+	Config          CohereConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+}
+
+type CohereRequest struct {
+	Model         string          `json:"model"`
+	Messages      []OpenAIMessage `json:"messages"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	P             *float64        `json:"p,omitempty"`
+	K             *int            `json:"k,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	// ResponseFormat {"type": "json_object"} constrains the output to
+	// valid JSON.
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+type CohereResponse struct {
+	Message struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"message"`
+	FinishReason string `json:"finish_reason"`
+}
+
+func (p *CohereProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	model := p.Config.Model
+	if model == "" {
+		model = defaultCohereModel
+	}
+	generation := p.Config.Generation
+	cohereReq := CohereRequest{
+		Model:          model,
+		Messages:       []OpenAIMessage{{Role: "user", Content: prompt}},
+		MaxTokens:      generation.maxOutputTokens(p.MaxOutputTokens),
+		Temperature:    generation.Temperature,
+		P:              generation.TopP,
+		K:              generation.TopK,
+		StopSequences:  generation.StopSequences,
+		ResponseFormat: map[string]string{"type": "json_object"},
+	}
+
+	bodyBytes, err := json.Marshal(cohereReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	endpoint := p.Config.APIEndpoint
+	if endpoint == "" {
+		endpoint = defaultCohereEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setProviderHeaders(req, map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer {{AI_API_KEY}}",
+	}, p.Config.Headers, apiKey)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %s: %s", resp.Status, string(body))
+	}
+
+	var cohereResp CohereResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cohereResp); err != nil {
+		return nil, fmt.Errorf("failed to decode cohere response: %w", err)
+	}
+	if cohereResp.FinishReason == "MAX_TOKENS" {
+		return nil, errOutputTruncated
+	}
+
+	for _, block := range cohereResp.Message.Content {
+		if block.Type == "text" {
+			return parseAnalysisResult(block.Text, "cohere")
+		}
+	}
+	return nil, fmt.Errorf("no text content found in cohere response")
+}
+
+func (p *CohereProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Matrix jobs each park their results in a hidden, per-job marker comment.
+// A final "combine" invocation reads every job comment, merges the results
+// into a single summary comment and removes the per-job comments.
+const jobMarkerPrefix = "<!-- semantic-lint:job="
+
+func jobMarker(jobID string) string {
+	return jobMarkerPrefix + jobID + " -->"
+}
+
+// listIssueComments returns every comment on the pull request, following
+// pagination.
+func listIssueComments(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	var all []*github.IssueComment
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, comments...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func renderJobComment(jobID string, results []*FileAnalysisResult) (string, error) {
+	data, err := encodeHiddenData("data", results)
+	if err != nil {
+		return "", err
+	}
+
+	var body strings.Builder
+	body.WriteString(jobMarker(jobID) + "\n")
+	body.WriteString(data + "\n")
+	body.WriteString(fmt.Sprintf("Semantic linting results for job `%s` are waiting to be combined.\n", jobID))
+	return body.String(), nil
+}
+
+// postJobResults stores results for one matrix job, replacing the job's
+// previous comment if there is one.
+func postJobResults(ctx context.Context, client *github.Client, owner, repo string, prNumber int, jobID string, results []*FileAnalysisResult) error {
+	body, err := renderJobComment(jobID, results)
+	if err != nil {
+		return err
+	}
+
+	comments, err := listOwnIssueComments(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+
+	marker := jobMarker(jobID)
+	for _, c := range comments {
+		if strings.HasPrefix(c.GetBody(), marker) {
+			_, _, err := client.Issues.EditComment(ctx, owner, repo, c.GetID(), &github.IssueComment{Body: &body})
+			return err
+		}
+	}
+
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: &body})
+	return err
+}
+
+// collectJobResults reads back the results of every job comment on the pull
+// request. Results for the same file reported by several jobs are merged.
+// Only the comments written with the same token are jobs', so no one else
+// can add results or have a comment deleted as a job's.
+func collectJobResults(ctx context.Context, client *github.Client, owner, repo string, prNumber int, config *Config) ([]*FileAnalysisResult, []*github.IssueComment, error) {
+	comments, err := listOwnIssueComments(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+
+	merged := NewAggregator(config)
+	var jobComments []*github.IssueComment
+	for _, c := range comments {
+		if !strings.HasPrefix(c.GetBody(), jobMarkerPrefix) {
+			continue
+		}
+		var results []*FileAnalysisResult
+		found, err := decodeHiddenData(c.GetBody(), "data", &results)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read job comment %d: %w", c.GetID(), err)
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("job comment %d has no results data", c.GetID())
+		}
+		merged.Add(results...)
+		jobComments = append(jobComments, c)
+	}
+	return merged.Results(), jobComments, nil
+}
+
+func deleteComments(ctx context.Context, client *github.Client, owner, repo string, comments []*github.IssueComment) error {
+	for _, c := range comments {
+		if _, err := client.Issues.DeleteComment(ctx, owner, repo, c.GetID()); err != nil {
+			return fmt.Errorf("failed to delete comment %d: %w", c.GetID(), err)
+		}
+	}
+	return nil
+}
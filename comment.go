@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Report is everything a run produced that ends up in the PR comment.
+type Report struct {
+	Results     []*FileAnalysisResult
+	BinaryFiles []*ChangedFile
+	Interrupted bool
+	// TotalFiles is the number of files selected for analysis, including
+	// the ones that were skipped or failed.
+	TotalFiles    int
+	BudgetReached bool
+	NotAnalyzed   []string
+	// Analyzed lists the files this run sent to the provider and got
+	// results for, leaving out reused results and the heuristics' issues.
+	Analyzed []string
+	// Failed lists the files the provider could not analyze.
+	Failed []string
+	// Score is the weighted quality score, or nil when scoring is off.
+	Score *int
+	// SuggestionsDropped counts suggested code removed by validation.
+	SuggestionsDropped int
+	// FormatViolations counts responses that weren't pure JSON. It is only
+	// counted with ai.strictJSON.
+	FormatViolations int
+	// Usage is the token usage reported by the provider over the run.
+	// Its counts are unknown unless a provider reported them.
+	Usage TokenUsage
+	// Summary holds the results to render when some issues were posted
+	// elsewhere, e.g. as inline review comments. Nil means all Results.
+	Summary     []*FileAnalysisResult
+	InlineCount int
+	// Reused lists the files whose results were carried over from the
+	// previous run because they haven't changed since.
+	Reused []string
+	// HeadSHA is the commit issues are linked to with comment.permalinks,
+	// or "" for no links.
+	HeadSHA string
+}
+
+func (r *Report) summaryResults() []*FileAnalysisResult {
+	if r.Summary != nil {
+		return r.Summary
+	}
+	return r.Results
+}
+
+// complete reports whether the run analyzed every file: it wasn't
+// interrupted or stopped by the budget, and the provider failed on none.
+func (r *Report) complete() bool {
+	return !r.Interrupted && !r.BudgetReached && len(r.Failed) == 0
+}
+
+// clean reports whether the run analyzed every file and found no issues.
+func (r *Report) clean() bool {
+	return countIssues(r.Results) == 0 && r.complete()
+}
+
+func renderComment(report *Report, config *Config) string {
+	comment := summaryHeading + "\n\n" + renderNotices(report, config)
+	if countIssues(report.Results) == 0 {
+		// The notices above say what wasn't analyzed, so only a complete
+		// run gets the all-clear.
+		if report.clean() {
+			comment += "✅ No issues found.\n\n"
+		} else {
+			comment += "No issues found in the analyzed files.\n\n"
+		}
+		if len(report.BinaryFiles) > 0 {
+			comment += renderDetails(report, config)
+		}
+	} else {
+		comment += renderSummaryTable(report.Results, config) + renderDetails(report, config)
+	}
+	if config.Feedback.Enabled {
+		comment += feedbackPrompt + "\n"
+	}
+	return comment
+}
+
+// renderNotices renders the banners that qualify the results, such as a
+// partial run.
+func renderNotices(report *Report, config *Config) string {
+	var out strings.Builder
+	if report.Score != nil {
+		out.WriteString(fmt.Sprintf("**Score: %d/100**\n\n", *report.Score))
+	}
+	if report.Interrupted {
+		out.WriteString("> ⏹️ The run was interrupted before all files were analyzed. Results below are partial.\n\n")
+	}
+	if report.BudgetReached {
+		out.WriteString(renderBudgetBanner(report, config))
+	}
+	if len(report.Failed) > 0 && config.AI.onProviderError() != providerErrorSkip {
+		out.WriteString(fmt.Sprintf("> ⚠️ %d file(s) could not be analyzed because the AI provider failed:\n", len(report.Failed)))
+		for _, filename := range report.Failed {
+			out.WriteString(fmt.Sprintf("> - `%s`\n", filename))
+		}
+		out.WriteString("\n")
+	}
+	if report.InlineCount > 0 {
+		out.WriteString(fmt.Sprintf("%d issue(s) were posted as inline review comments.\n\n", report.InlineCount))
+	}
+	if report.SuggestionsDropped > 0 {
+		out.WriteString(fmt.Sprintf("%d suggested change(s) were left out because they did not parse.\n\n", report.SuggestionsDropped))
+	}
+	return out.String()
+}
+
+// renderSummaryTable renders the error and warning counts of every file with
+// issues. It renders nothing when there are no issues.
+func renderSummaryTable(results []*FileAnalysisResult, config *Config) string {
+	var out strings.Builder
+	for _, result := range results {
+		if len(result.Issues) == 0 {
+			continue
+		}
+		if out.Len() == 0 {
+			out.WriteString("| File | 🔴 Errors | ⚠️ Warnings |\n")
+			out.WriteString("| --- | ---: | ---: |\n")
+		}
+		errors, warnings := countSeverities([]*FileAnalysisResult{result}, config)
+		out.WriteString(fmt.Sprintf("| `%s` | %d | %d |\n", result.Filename, errors, warnings))
+	}
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// renderDetails renders every issue grouped as set by comment.groupBy,
+// followed by the binary files section.
+func renderDetails(report *Report, config *Config) string {
+	var comment strings.Builder
+	results := report.summaryResults()
+	switch config.Comment.GroupBy {
+	case groupBySeverity:
+		isError := func(issue Issue) bool { return issueSeverity(issue, config) == "error" }
+		renderGroup(&comment, "🔴 Must fix", filterIssues(results, isError), report.HeadSHA, config)
+		renderGroup(&comment, "⚠️ Consider", filterIssues(results, func(issue Issue) bool { return !isError(issue) }), report.HeadSHA, config)
+	case groupByCategory:
+		for _, category := range issueCategories(results) {
+			title := category
+			if title == "" {
+				title = "General"
+			}
+			inCategory := func(issue Issue) bool { return issue.Category == category }
+			renderGroup(&comment, title, filterIssues(results, inCategory), report.HeadSHA, config)
+		}
+	default:
+		renderFileSections(&comment, "###", results, report.HeadSHA, config)
+	}
+
+	if len(report.BinaryFiles) > 0 {
+		comment.WriteString("### Binary and image files\n\n")
+		comment.WriteString("These files changed but were not analyzed:\n\n")
+		for _, file := range report.BinaryFiles {
+			comment.WriteString(fmt.Sprintf("- `%s` (%s)\n", file.Filename, file.Status))
+		}
+		comment.WriteString("\n")
+	}
+
+	return comment.String()
+}
+
+// renderGroup renders a titled group of files, or nothing when the group
+// has no issues.
+func renderGroup(out *strings.Builder, title string, results []*FileAnalysisResult, headSHA string, config *Config) {
+	if countIssues(results) == 0 {
+		return
+	}
+	out.WriteString(fmt.Sprintf("### %s\n\n", title))
+	renderFileSections(out, "####", results, headSHA, config)
+}
+
+// permalink renders a link to the lines an issue is about, in the file as
+// of commit sha.
+func permalink(filename string, issue Issue, sha string) string {
+	segments := strings.Split(filename, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	lines := fmt.Sprintf("L%d", issue.Line)
+	if issue.EndLine > issue.Line {
+		lines += fmt.Sprintf("-L%d", issue.EndLine)
+	}
+	return fmt.Sprintf("([%s](%s/%s/blob/%s/%s#%s))", lines, serverURL(), os.Getenv("GITHUB_REPOSITORY"), sha, strings.Join(segments, "/"), lines)
+}
+
+// renderFileSections renders a section per file with issues, under headings
+// of the given level.
+func renderFileSections(out *strings.Builder, heading string, results []*FileAnalysisResult, headSHA string, config *Config) {
+	for _, result := range results {
+		if len(result.Issues) == 0 {
+			continue
+		}
+		out.WriteString(fmt.Sprintf("%s %s\n\n", heading, result.Filename))
+		for _, issue := range result.Issues {
+			severityIcon := "⚠️"
+			if issueSeverity(issue, config) == "error" {
+				severityIcon = "🔴"
+			}
+			label := issue.Type
+			if issue.Category != "" {
+				label = issue.Category + "/" + issue.Type
+			}
+			out.WriteString(fmt.Sprintf("%s **%s**: %s", severityIcon, label, issue.Message))
+			if headSHA != "" && issue.Line > 0 {
+				out.WriteString(" " + permalink(result.Filename, issue, headSHA))
+			}
+			out.WriteString("\n")
+			if issue.Suggestion != "" {
+				out.WriteString(fmt.Sprintf("> Suggestion: %s\n", issue.Suggestion))
+			}
+			if issue.SuggestedCode != "" {
+				out.WriteString(fmt.Sprintf("\n```%s\n%s\n```\n", detectLanguage(result.Filename), issue.SuggestedCode))
+			}
+			out.WriteString("\n")
+		}
+	}
+}
+
+// filterIssues returns a copy of results holding only the issues keep
+// accepts, preserving the order of files and issues.
+func filterIssues(results []*FileAnalysisResult, keep func(Issue) bool) []*FileAnalysisResult {
+	filtered := make([]*FileAnalysisResult, 0, len(results))
+	for _, result := range results {
+		kept := &FileAnalysisResult{Filename: result.Filename, SHA: result.SHA}
+		for _, issue := range result.Issues {
+			if keep(issue) {
+				kept.Issues = append(kept.Issues, issue)
+			}
+		}
+		filtered = append(filtered, kept)
+	}
+	return filtered
+}
+
+// issueCategories returns the distinct issue categories in sorted order,
+// with uncategorized issues ("") first.
+func issueCategories(results []*FileAnalysisResult) []string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, result := range results {
+		for _, issue := range result.Issues {
+			if !seen[issue.Category] {
+				seen[issue.Category] = true
+				categories = append(categories, issue.Category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// sortResults orders results according to comment.sortBy. The sort is
+// stable and falls back to the filename, so the same results always render
+// in the same order.
+func sortResults(results []*FileAnalysisResult, config *Config) {
+	switch config.Comment.SortBy {
+	case "none":
+		return
+	case "severity":
+		weight := func(result *FileAnalysisResult) float64 {
+			total := 0.0
+			for _, issue := range result.Issues {
+				total += issueWeight(issue, config)
+			}
+			return total
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			wi, wj := weight(results[i]), weight(results[j])
+			if wi != wj {
+				return wi > wj
+			}
+			return results[i].Filename < results[j].Filename
+		})
+	default:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Filename < results[j].Filename
+		})
+	}
+}
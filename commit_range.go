@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// CommitRange is a range of commits analyzed without a pull request: the
+// commits a push added to a branch, a merge queue's merge group, or the
+// base and head refs given as inputs to a manual run. There is no pull
+// request to comment on, so the results are reported through the check
+// run and commit status on Head.
+type CommitRange struct {
+	// Ref is the full name of the head branch, e.g. refs/heads/main.
+	Ref  string
+	Base string
+	Head string
+}
+
+// errBranchDeleted is returned for a push that deleted a branch, which has
+// no commits to analyze.
+var errBranchDeleted = errors.New("the push deleted the branch")
+
+// commitRangeFromEvent returns the range of commits of a push or
+// merge_group event, or nil for any other event.
+func commitRangeFromEvent() (*CommitRange, error) {
+	event := os.Getenv("GITHUB_EVENT_NAME")
+	if event != "push" && event != "merge_group" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event file: %w", err)
+	}
+	var payload struct {
+		Ref        string `json:"ref"`
+		Before     string `json:"before"`
+		After      string `json:"after"`
+		Deleted    bool   `json:"deleted"`
+		MergeGroup struct {
+			HeadSHA string `json:"head_sha"`
+			HeadRef string `json:"head_ref"`
+			BaseSHA string `json:"base_sha"`
+		} `json:"merge_group"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+
+	if event == "push" && (payload.Deleted || (payload.After != "" && isZeroSHA(payload.After))) {
+		return nil, errBranchDeleted
+	}
+	commits := &CommitRange{Ref: payload.Ref, Base: payload.Before, Head: payload.After}
+	if event == "merge_group" {
+		// The merge group's head is the queued pull requests merged onto
+		// the base branch, so the range covers all of them.
+		group := payload.MergeGroup
+		commits = &CommitRange{Ref: group.HeadRef, Base: group.BaseSHA, Head: group.HeadSHA}
+	}
+	if commits.Head == "" || isZeroSHA(commits.Head) {
+		return nil, fmt.Errorf("the %s event has no head commit", event)
+	}
+	return commits, nil
+}
+
+// commitRangeFromInputs returns the range named by the base-ref and
+// head-ref inputs, e.g. for a workflow_dispatch run on an arbitrary
+// branch, or nil when they aren't set. The head is resolved to a commit
+// so results are reported on the commit that was analyzed even if the
+// branch moves meanwhile.
+func commitRangeFromInputs(ctx context.Context, client *github.Client, owner, repo string) (*CommitRange, error) {
+	base, head := os.Getenv("INPUT_BASE-REF"), os.Getenv("INPUT_HEAD-REF")
+	if base == "" && head == "" {
+		return nil, nil
+	}
+	if base == "" || head == "" {
+		return nil, fmt.Errorf("base-ref and head-ref must be set together")
+	}
+	sha, _, err := client.Repositories.GetCommitSHA1(ctx, owner, repo, head, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", head, err)
+	}
+	ref := head
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/heads/" + ref
+	}
+	return &CommitRange{Ref: ref, Base: base, Head: sha}, nil
+}
+
+// isZeroSHA reports whether sha is the all-zero SHA GitHub sends as the
+// before commit of a new branch and the after commit of a deleted one.
+func isZeroSHA(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// maxCompareFiles is the most files GitHub lists for a comparison. Paging
+// doesn't help: only the first page has files, and it lists at most this
+// many.
+const maxCompareFiles = 300
+
+// getRangeChangedFiles returns the files changed between the range's base
+// and head. A push that creates a branch has no before commit and is
+// compared against the pushed commit's parent instead.
+func getRangeChangedFiles(ctx context.Context, client *github.Client, owner, repo string, commits *CommitRange) ([]*ChangedFile, []*ChangedFile, error) {
+	base := commits.Base
+	if base == "" || isZeroSHA(base) {
+		base = commits.Head + "^"
+	}
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, repo, base, commits.Head, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(comparison.Files) >= maxCompareFiles {
+		fmt.Printf("::warning::GitHub lists at most %d changed files for %s..%s; any further files are not analyzed.\n", maxCompareFiles, base, commits.Head)
+	}
+	changedFiles, binaryFiles := splitCommitFiles(comparison.Files)
+	return changedFiles, binaryFiles, nil
+}
+
+// headCommit returns the commit being analyzed: the head of the commit
+// range, or else the pull request head.
+func headCommit(ctx context.Context, client *github.Client, owner, repo string, prNumber int, commits *CommitRange) (string, error) {
+	if commits != nil {
+		return commits.Head, nil
+	}
+	return getPullRequestHead(ctx, client, owner, repo, prNumber)
+}
+
+// publishCommit reports the results of a commit range through the outputs
+// that don't need a pull request: the tracking issue, the check run, the
+// commit status and the SARIF upload.
+func (p *Publisher) publishCommit(ctx context.Context, report *Report) error {
+	config := p.Config
+	if p.DryRun {
+		fmt.Printf("Dry run: not reporting results for commit %s.\n", p.HeadSHA)
+		return nil
+	}
+	if p.ReportTo == "issue" {
+		if err := postTrackingIssue(ctx, p.Client, p.Owner, p.Repo, report, p.Patches, config); err != nil {
+			return fmt.Errorf("failed to post tracking issue: %w", err)
+		}
+	}
+	if config.Check.Enabled {
+		if err := createCheckRun(ctx, p.Client, p.Owner, p.Repo, 0, p.HeadSHA, report, config); err != nil {
+			return fmt.Errorf("failed to create check run: %w", err)
+		}
+	}
+	if config.Status.Enabled {
+		if err := setCommitStatus(ctx, p.Client, p.Owner, p.Repo, p.HeadSHA, report, config); err != nil {
+			return fmt.Errorf("failed to set commit status: %w", err)
+		}
+	}
+	if p.UploadSARIF {
+		if err := uploadSARIF(ctx, p.Client, p.Owner, p.Repo, p.Ref, p.HeadSHA, report, config); err != nil {
+			return fmt.Errorf("failed to upload SARIF: %w", err)
+		}
+	}
+	return nil
+}
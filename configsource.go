@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// fileReader reads a repository file by its path from the repository root.
+type fileReader func(path string) (string, error)
+
+func readLocalFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func refFileReader(ctx context.Context, client *github.Client, owner, repo, ref string) fileReader {
+	return func(path string) (string, error) {
+		return getFileContent(ctx, client, owner, repo, path, ref)
+	}
+}
+
+// configReader decides which version of the config and rules a pull request
+// is linted with. By default that is the version on the base commit, so a
+// pull request can't weaken the linter that checks it. If the base config
+// sets useHeadConfig, the head version is used, which is handy while
+// iterating on the rules. When the base has no config yet, e.g. in the pull
+// request that adds the linter, the local checkout is used. The config path
+// is returned too, since the default falls back to YAML in the version read.
+func configReader(ctx context.Context, client *github.Client, owner, repo string, prNumber int, configPath string) (fileReader, string, error) {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNumber)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get pull request: %w", err)
+	}
+
+	readBase := refFileReader(ctx, client, owner, repo, pr.GetBase().GetSHA())
+	configPath = resolveConfigPath(configPath, readBase)
+	content, err := readBase(configPath)
+	if err != nil {
+		fmt.Printf("No config on the base commit (%v), using the local checkout.\n", err)
+		return readLocalFile, resolveConfigPath(configPath, readLocalFile), nil
+	}
+	baseConfig, err := parseConfig(configPath, []byte(content))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse base config: %w", err)
+	}
+
+	if baseConfig.UseHeadConfig {
+		fmt.Println("Using config and rules from the pull request head.")
+		return refFileReader(ctx, client, owner, repo, pr.GetHead().GetSHA()), configPath, nil
+	}
+	fmt.Println("Using config and rules from the pull request base.")
+	return readBase, configPath, nil
+}
+
+// loadRepoContext returns the repository context from ai.repoContext, or
+// from the file named by ai.repoContextFile. Setting both is an error.
+func loadRepoContext(config AIConfig, readFile fileReader) (string, error) {
+	if config.RepoContextFile == "" {
+		return config.RepoContext, nil
+	}
+	if config.RepoContext != "" {
+		return "", fmt.Errorf("set only one of ai.repoContext and ai.repoContextFile")
+	}
+	return readFile(config.RepoContextFile)
+}
+
+// contentHash identifies content by its short SHA-256.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ConsensusConfig has every patch analyzed by several providers and keeps
+// only the issues enough of them agree on, which filters out findings a
+// single model hallucinated.
+type ConsensusConfig struct {
+	// Providers are analyzed alongside ai.provider.
+	Providers []FallbackProviderConfig `json:"providers"`
+	// Quorum is how many providers must report an issue for it to be
+	// kept. Defaults to a majority.
+	Quorum int `json:"quorum"`
+}
+
+// consensusLineTolerance is how far apart two providers' line numbers for
+// the same issue type may be while still counting as the same issue.
+const consensusLineTolerance = 3
+
+// ConsensusProvider runs every member on the same prompt in parallel.
+type ConsensusProvider struct {
+	Members []ProviderStep
+	Quorum  int
+}
+
+func newConsensusProvider(primary LLMProvider, config *Config) (*ConsensusProvider, error) {
+	steps, err := newProviderSteps(config.AI.Consensus.Providers, config)
+	if err != nil {
+		return nil, fmt.Errorf("ai.consensus: %w", err)
+	}
+	members := append([]ProviderStep{{Name: config.AI.Provider, Provider: primary}}, steps...)
+	quorum := config.AI.Consensus.Quorum
+	if quorum <= 0 {
+		quorum = len(members)/2 + 1
+	}
+	if quorum > len(members) {
+		return nil, fmt.Errorf("ai.consensus.quorum %d exceeds the %d providers", quorum, len(members))
+	}
+	return &ConsensusProvider{Members: members, Quorum: quorum}, nil
+}
+
+func (p *ConsensusProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	results := make([]*AnalysisResult, len(p.Members))
+	errs := make([]error, len(p.Members))
+	var wg sync.WaitGroup
+	for i, member := range p.Members {
+		wg.Add(1)
+		go func(i int, member ProviderStep) {
+			defer wg.Done()
+			key := member.APIKey
+			if key == "" {
+				key = apiKey
+			}
+			result, err := member.Provider.Analyze(ctx, patch, prompt, key)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", member.Name, err)
+				return
+			}
+			results[i] = result
+		}(i, member)
+	}
+	wg.Wait()
+
+	var answered []*AnalysisResult
+	for i, result := range results {
+		if result == nil {
+			fmt.Fprintf(progress, "  Consensus member %v\n", errs[i])
+			continue
+		}
+		answered = append(answered, result)
+	}
+	if len(answered) < p.Quorum {
+		return nil, fmt.Errorf("only %d of %d providers answered, below the quorum of %d: %w", len(answered), len(p.Members), p.Quorum, errors.Join(errs...))
+	}
+
+	merged := &AnalysisResult{}
+	for _, result := range answered {
+		merged.NeedContext = append(merged.NeedContext, result.NeedContext...)
+		merged.FormatViolation = merged.FormatViolation || result.FormatViolation
+		merged.Usage.add(result.Usage)
+		for _, issue := range result.Issues {
+			if containsMatchingIssue(merged.Issues, issue) {
+				continue
+			}
+			support := 0
+			for _, other := range answered {
+				if containsMatchingIssue(other.Issues, issue) {
+					support++
+				}
+			}
+			if support >= p.Quorum {
+				merged.Issues = append(merged.Issues, issue)
+			}
+		}
+	}
+	return merged, nil
+}
+
+// containsMatchingIssue reports whether issues has one of the same type as
+// issue at about the same line.
+func containsMatchingIssue(issues []Issue, issue Issue) bool {
+	for _, other := range issues {
+		if other.Type != issue.Type {
+			continue
+		}
+		diff := other.Line - issue.Line
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= consensusLineTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// WithModel switches the model of the primary member only.
+func (p *ConsensusProvider) WithModel(model string) LLMProvider {
+	selectable, ok := p.Members[0].Provider.(ModelSelectable)
+	if !ok {
+		return p
+	}
+	clone := &ConsensusProvider{Members: append([]ProviderStep(nil), p.Members...), Quorum: p.Quorum}
+	clone.Members[0].Provider = selectable.WithModel(model)
+	return clone
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ContextRequestsConfig lets the model ask for the definition of a symbol
+// from another file before it answers. Each patch gets at most one extra
+// round, so enabling this at most doubles the number of provider calls.
+type ContextRequestsConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxFiles caps how many requested files are fetched per patch.
+	MaxFiles int `json:"maxFiles"`
+	// MaxBytes caps how much of each fetched file is sent back.
+	MaxBytes int `json:"maxBytes"`
+}
+
+// ContextRequest is a model's request to see a file, optionally narrowed to
+// the part around a symbol.
+type ContextRequest struct {
+	Path   string `json:"path"`
+	Symbol string `json:"symbol,omitempty"`
+}
+
+const (
+	defaultContextMaxFiles = 3
+	defaultContextMaxBytes = 16000
+	// contextSymbolWindow is how many lines around a requested symbol are
+	// returned.
+	contextSymbolWindow = 40
+)
+
+const contextRequestInstructions = `
+
+If you cannot judge the changes without seeing a definition from another file in the repository, you may instead respond once with JSON of the form {"needContext": [{"path": "path/from/repo/root", "symbol": "OptionalName"}]} and no issues. You will then receive the requested code.`
+
+// resolveContextRequests fetches the requested files and renders them for
+// the follow-up prompt. Files that can't be fetched are reported to the
+// model as unavailable rather than failing the analysis.
+func (a *Analyzer) resolveContextRequests(ctx context.Context, requests []ContextRequest) string {
+	maxFiles := a.Config.AI.ContextRequests.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultContextMaxFiles
+	}
+	maxBytes := a.Config.AI.ContextRequests.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultContextMaxBytes
+	}
+	if len(requests) > maxFiles {
+		requests = requests[:maxFiles]
+	}
+
+	var out strings.Builder
+	for _, request := range requests {
+		fmt.Fprintf(progress, "  Model requested context: %s %s\n", request.Path, request.Symbol)
+		content, err := a.FetchFile(ctx, request.Path)
+		if err != nil {
+			out.WriteString(fmt.Sprintf("\n### %s\n\n(unavailable: %v)\n", request.Path, err))
+			continue
+		}
+		if request.Symbol != "" {
+			content = symbolWindow(content, request.Symbol)
+		}
+		if len(content) > maxBytes {
+			content = content[:maxBytes] + "\n... (truncated)"
+		}
+		out.WriteString(fmt.Sprintf("\n### %s\n\n```\n%s\n```\n", request.Path, content))
+	}
+	return out.String()
+}
+
+// symbolWindow returns the lines around the first mention of symbol, or the
+// whole content if it isn't mentioned.
+func symbolWindow(content, symbol string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, symbol) {
+			continue
+		}
+		start := max(0, i-contextSymbolWindow/4)
+		end := min(len(lines), i+contextSymbolWindow)
+		return strings.Join(lines[start:end], "\n")
+	}
+	return content
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRequestTimeoutSeconds = 300
+	defaultStallTimeoutSeconds   = 60
+	defaultRequestAttempts       = 2
+)
+
+// DeadlineConfig bounds how long one provider request may take. Responses
+// are streamed where the provider supports it, so a generation that stops
+// producing output is noticed long before the request deadline.
+type DeadlineConfig struct {
+	// Streaming defaults to true for Gemini, OpenAI, Anthropic and the
+	// providers built on them.
+	Streaming *bool `json:"streaming"`
+	// RequestTimeoutSeconds is the most one request may take, including
+	// the whole response.
+	RequestTimeoutSeconds int `json:"requestTimeoutSeconds"`
+	// StallTimeoutSeconds aborts a response that sends nothing for this
+	// long.
+	StallTimeoutSeconds int `json:"stallTimeoutSeconds"`
+	// Attempts is how many times a request that timed out or stalled is
+	// sent before the file fails.
+	Attempts int `json:"attempts"`
+}
+
+func (c DeadlineConfig) streaming() bool {
+	return c.Streaming == nil || *c.Streaming
+}
+
+func (c DeadlineConfig) requestTimeout() time.Duration {
+	if c.RequestTimeoutSeconds > 0 {
+		return time.Duration(c.RequestTimeoutSeconds) * time.Second
+	}
+	return defaultRequestTimeoutSeconds * time.Second
+}
+
+func (c DeadlineConfig) stallTimeout() time.Duration {
+	if c.StallTimeoutSeconds > 0 {
+		return time.Duration(c.StallTimeoutSeconds) * time.Second
+	}
+	return defaultStallTimeoutSeconds * time.Second
+}
+
+func (c DeadlineConfig) attempts() int {
+	if c.Attempts > 0 {
+		return c.Attempts
+	}
+	return defaultRequestAttempts
+}
+
+// errStalled is returned when a response body sends nothing for longer than
+// the stall timeout.
+var errStalled = errors.New("response stalled")
+
+// stallTransport cuts off response bodies that stop sending data.
+type stallTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *stallTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = newStallReader(resp.Body, t.timeout)
+	return resp, nil
+}
+
+// stallReader closes the body when no data arrives within the timeout,
+// which unblocks a pending Read, and reports errStalled from then on.
+type stallReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+func newStallReader(body io.ReadCloser, timeout time.Duration) *stallReader {
+	r := &stallReader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.stalled.Store(true)
+		body.Close()
+	})
+	return r
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if r.stalled.Load() {
+		return n, errStalled
+	}
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+// call sends one prompt to the provider under the request deadline and
+// counts responses that weren't pure JSON when ai.strictJSON is set.
+func (a *Analyzer) call(ctx context.Context, provider LLMProvider, patch, prompt string) (*AnalysisResult, error) {
+	result, err := withDeadline(provider, a.Config.AI.Deadline).Analyze(ctx, patch, prompt, a.APIKey)
+	if err == nil {
+		a.usage.add(result.Usage)
+	}
+	if err == nil && result.FormatViolation && a.Config.AI.StrictJSON {
+		a.formatViolations++
+		fmt.Fprintln(progress, "::warning::The model's response was not pure JSON; the result was extracted from surrounding text.")
+	}
+	return result, err
+}
+
+// withDeadline applies the deadline to each request the provider sends. In
+// a fallback chain or consensus group it applies to every member on its
+// own, so a member that times out or stalls leaves the others their full
+// deadline and a chain still falls through to the next provider.
+func withDeadline(provider LLMProvider, deadline DeadlineConfig) LLMProvider {
+	switch p := provider.(type) {
+	case *FallbackProvider:
+		return &FallbackProvider{Chain: stepsWithDeadline(p.Chain, deadline)}
+	case *ConsensusProvider:
+		return &ConsensusProvider{Members: stepsWithDeadline(p.Members, deadline), Quorum: p.Quorum}
+	}
+	return &deadlineProvider{provider: provider, deadline: deadline}
+}
+
+func stepsWithDeadline(steps []ProviderStep, deadline DeadlineConfig) []ProviderStep {
+	wrapped := append([]ProviderStep(nil), steps...)
+	for i := range wrapped {
+		wrapped[i].Provider = withDeadline(wrapped[i].Provider, deadline)
+	}
+	return wrapped
+}
+
+// deadlineProvider sends each prompt under the request deadline, resending
+// it when it timed out or stalled.
+type deadlineProvider struct {
+	provider LLMProvider
+	deadline DeadlineConfig
+}
+
+func (p *deadlineProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	var result *AnalysisResult
+	var err error
+	for attempt := 1; attempt <= p.deadline.attempts(); attempt++ {
+		requestCtx, cancel := context.WithTimeout(ctx, p.deadline.requestTimeout())
+		result, err = p.provider.Analyze(requestCtx, patch, prompt, apiKey)
+		timedOut := requestCtx.Err() == context.DeadlineExceeded
+		cancel()
+		if err == nil || ctx.Err() != nil || !(timedOut || errors.Is(err, errStalled)) {
+			break
+		}
+		if timedOut {
+			err = fmt.Errorf("request exceeded its %s deadline: %w", p.deadline.requestTimeout(), err)
+		}
+		if attempt < p.deadline.attempts() {
+			fmt.Fprintf(progress, "::warning::Provider request failed (%v), retrying (attempt %d of %d).\n", err, attempt+1, p.deadline.attempts())
+		}
+	}
+	return result, err
+}
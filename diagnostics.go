@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Diagnostic is the single-line JSON form of an issue written to the JSONL
+// stream. Line is 0 when the model did not report one.
+type Diagnostic struct {
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Line     int    `json:"line"`
+}
+
+// diagnosticWriter streams one JSON object per issue as files are analyzed.
+// A nil writer discards everything, so callers don't need to check whether
+// the stream is enabled.
+type diagnosticWriter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// openDiagnosticWriter opens the JSONL stream named by INPUT_JSONL. "-"
+// selects stderr so the stream never interleaves with the human-readable log
+// on stdout; anything else is a file path.
+func openDiagnosticWriter(target string) (*diagnosticWriter, error) {
+	switch target {
+	case "":
+		return nil, nil
+	case "-":
+		return &diagnosticWriter{enc: json.NewEncoder(os.Stderr)}, nil
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	return &diagnosticWriter{enc: json.NewEncoder(f), closer: f}, nil
+}
+
+func (w *diagnosticWriter) writeResult(result *FileAnalysisResult, config *Config) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, issue := range result.Issues {
+		err := w.enc.Encode(Diagnostic{
+			Filename: result.Filename,
+			Type:     issue.Type,
+			Severity: issueSeverity(issue, config),
+			Message:  issue.Message,
+			Line:     issue.Line,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *diagnosticWriter) Close() error {
+	if w == nil || w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
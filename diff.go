@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DiffLine is a line of a unified diff patch that exists in the new version
+// of the file, i.e. on the RIGHT side of a GitHub diff.
+type DiffLine struct {
+	// NewLine is the 1-based line number in the new version of the file.
+	NewLine int
+	// Added is true for lines added by the patch, false for context lines.
+	Added bool
+	Text  string
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunkLengths returns the number of old and new lines a hunk header
+// announces. A length left out is 1.
+func hunkLengths(header string) (oldLines, newLines int) {
+	match := hunkHeaderPattern.FindStringSubmatch(header)
+	if match == nil {
+		return 0, 0
+	}
+	length := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return length(match[1]), length(match[3])
+}
+
+// parsePatch returns the added and context lines of a patch as GitHub
+// reports it in the pull request file list. Removed lines are skipped since
+// they have no line number in the new file.
+func parsePatch(patch string) []DiffLine {
+	var lines []DiffLine
+	newLine := 0
+	for _, line := range strings.Split(patch, "\n") {
+		if match := hunkHeaderPattern.FindStringSubmatch(line); match != nil {
+			newLine, _ = strconv.Atoi(match[2])
+			continue
+		}
+		if newLine == 0 || line == "" {
+			continue
+		}
+		switch line[0] {
+		case '+':
+			lines = append(lines, DiffLine{NewLine: newLine, Added: true, Text: line[1:]})
+			newLine++
+		case ' ':
+			lines = append(lines, DiffLine{NewLine: newLine, Text: line[1:]})
+			newLine++
+		}
+	}
+	return lines
+}
+
+// numberPatchLines prefixes each added and context line of a patch with its
+// line number in the new file, so the model can report lines without
+// counting from the hunk headers. Removed lines get blank padding instead.
+func numberPatchLines(patch string) string {
+	var out strings.Builder
+	newLine := 0
+	for i, line := range strings.Split(patch, "\n") {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		if match := hunkHeaderPattern.FindStringSubmatch(line); match != nil {
+			newLine, _ = strconv.Atoi(match[2])
+			out.WriteString(line)
+			continue
+		}
+		if newLine == 0 || line == "" {
+			out.WriteString(line)
+			continue
+		}
+		switch line[0] {
+		case '+', ' ':
+			fmt.Fprintf(&out, "%5d %s", newLine, line)
+			newLine++
+		default:
+			out.WriteString("      " + line)
+		}
+	}
+	return out.String()
+}
+
+// commentableLines returns the new-file line numbers a review comment can be
+// attached to.
+func commentableLines(patch string) map[int]bool {
+	lines := make(map[int]bool)
+	for _, line := range parsePatch(patch) {
+		lines[line.NewLine] = true
+	}
+	return lines
+}
+
+// addedLineCount returns the number of lines a patch adds or changes.
+func addedLineCount(patch string) int {
+	count := 0
+	for _, line := range parsePatch(patch) {
+		if line.Added {
+			count++
+		}
+	}
+	return count
+}
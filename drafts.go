@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Draft pull request handling, set by drafts: "analyze" (default) treats
+// drafts like any pull request, "skip" doesn't run on them, and "quiet"
+// reports every issue as a warning annotation and in the job summary,
+// without comments, checks, statuses or labels, and never fails the run.
+// The skipped or quiet run is made up for when the pull request is marked
+// ready for review.
+const (
+	draftsAnalyze = "analyze"
+	draftsSkip    = "skip"
+	draftsQuiet   = "quiet"
+)
+
+func (c *Config) drafts() string {
+	if c.Drafts == "" {
+		return draftsAnalyze
+	}
+	return c.Drafts
+}
+
+// isDraftPullRequest reports whether the event is for a draft pull request.
+func isDraftPullRequest() bool {
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return false
+	}
+	var payload struct {
+		PullRequest struct {
+			Draft bool `json:"draft"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return false
+	}
+	return payload.PullRequest.Draft
+}
+
+// quietForDraft turns off every output that posts to the pull request.
+func quietForDraft(config *Config) {
+	config.Comment.Mode = commentModeNone
+	config.Check.Enabled = false
+	config.Status.Enabled = false
+	config.Labels = LabelsConfig{}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBaselineLength keeps the stored baseline well inside the issue body
+// limit, leaving room for the report itself.
+const maxBaselineLength = maxCommentLength / 2
+
+// Baseline is the set of findings a drift report compares against, stored
+// hidden in the tracking issue. Issues are kept as fingerprints per file so
+// a baseline of a whole-repository scan stays small.
+type Baseline struct {
+	RecordedAt string              `json:"recordedAt"`
+	Files      map[string][]string `json:"files"`
+}
+
+// issueFingerprint identifies an issue of a file across runs by its type
+// and the source lines it flags, with whitespace normalized. Neither the
+// line number nor the message is used: unrelated edits move issues around,
+// and the model words the same finding differently from run to run. An
+// issue without lines in the patch falls back to its message.
+func issueFingerprint(issue Issue, source map[int]string) string {
+	var flagged []string
+	for line := issue.Line; line > 0 && line <= max(issue.Line, issue.EndLine); line++ {
+		text, ok := source[line]
+		if !ok {
+			flagged = nil
+			break
+		}
+		flagged = append(flagged, strings.Join(strings.Fields(text), " "))
+	}
+	key := "message\x00" + strings.ToLower(strings.TrimSpace(issue.Message))
+	if len(flagged) > 0 {
+		key = "source\x00" + strings.Join(flagged, "\n")
+	}
+	sum := sha256.Sum256([]byte(issue.Type + "\x00" + key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// patchSource maps the line numbers of a patch's added and context lines
+// to their text.
+func patchSource(patch string) map[int]string {
+	source := make(map[int]string)
+	for _, line := range parsePatch(patch) {
+		source[line.NewLine] = line.Text
+	}
+	return source
+}
+
+// newBaseline records the fingerprints of the current results, whose
+// source is read from the analyzed patches. Files this run didn't analyze
+// keep their fingerprints from the previous baseline, so a failed or
+// interrupted run doesn't make their issues look fixed.
+func newBaseline(report *Report, patches map[string]string, previous *Baseline) *Baseline {
+	baseline := &Baseline{RecordedAt: time.Now().UTC().Format(time.RFC3339), Files: make(map[string][]string)}
+	for _, result := range report.Results {
+		source := patchSource(patches[result.Filename])
+		for _, issue := range result.Issues {
+			baseline.Files[result.Filename] = append(baseline.Files[result.Filename], issueFingerprint(issue, source))
+		}
+	}
+	if previous != nil {
+		for filename, fingerprints := range previous.Files {
+			if !mayResolve(filename, report) {
+				baseline.Files[filename] = fingerprints
+			}
+		}
+	}
+	return baseline
+}
+
+// Drift is how the current results differ from a baseline.
+type Drift struct {
+	// New holds the issues missing from the baseline.
+	New []*FileAnalysisResult
+	// Fixed counts, per file, the baseline issues no longer found.
+	Fixed map[string]int
+}
+
+// compareBaseline splits the current results into new issues and counts
+// the baseline issues that are gone. Repeated fingerprints are matched one
+// for one, so a second copy of a known issue counts as new.
+func compareBaseline(report *Report, patches map[string]string, baseline *Baseline) Drift {
+	remaining := make(map[string]map[string]int, len(baseline.Files))
+	for filename, fingerprints := range baseline.Files {
+		counts := make(map[string]int)
+		for _, fingerprint := range fingerprints {
+			counts[fingerprint]++
+		}
+		remaining[filename] = counts
+	}
+
+	drift := Drift{Fixed: make(map[string]int)}
+	for _, result := range report.Results {
+		added := &FileAnalysisResult{Filename: result.Filename, SHA: result.SHA}
+		source := patchSource(patches[result.Filename])
+		for _, issue := range result.Issues {
+			fingerprint := issueFingerprint(issue, source)
+			if remaining[result.Filename][fingerprint] > 0 {
+				remaining[result.Filename][fingerprint]--
+				continue
+			}
+			added.Issues = append(added.Issues, issue)
+		}
+		if len(added.Issues) > 0 {
+			drift.New = append(drift.New, added)
+		}
+	}
+	for filename, counts := range remaining {
+		if !mayResolve(filename, report) {
+			continue
+		}
+		for _, count := range counts {
+			drift.Fixed[filename] += count
+		}
+		if drift.Fixed[filename] == 0 {
+			delete(drift.Fixed, filename)
+		}
+	}
+	return drift
+}
+
+type regressionArea struct {
+	Dir   string
+	Count int
+}
+
+// regressionAreas counts new issues per directory, most first.
+func regressionAreas(results []*FileAnalysisResult) []regressionArea {
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[path.Dir(result.Filename)] += len(result.Issues)
+	}
+	areas := make([]regressionArea, 0, len(counts))
+	for dir, count := range counts {
+		areas = append(areas, regressionArea{dir, count})
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		if areas[i].Count != areas[j].Count {
+			return areas[i].Count > areas[j].Count
+		}
+		return areas[i].Dir < areas[j].Dir
+	})
+	return areas
+}
+
+// renderDriftReport renders the tracking issue body of a drift report: the
+// regression areas and new issues since the baseline, and the files with
+// fixed issues. Without a baseline it only notes that one was recorded.
+func renderDriftReport(report *Report, patches map[string]string, baseline *Baseline, config *Config) string {
+	var out strings.Builder
+	out.WriteString("## Semantic Linting Drift\n\n")
+	out.WriteString(renderNotices(report, config))
+	total := countIssues(report.Results)
+	if baseline == nil {
+		out.WriteString(fmt.Sprintf("Baseline recorded with %d issue(s). Later runs report the changes against it.\n", total))
+		return out.String()
+	}
+
+	drift := compareBaseline(report, patches, baseline)
+	fixed := 0
+	for _, count := range drift.Fixed {
+		fixed += count
+	}
+	out.WriteString(fmt.Sprintf("Since the baseline of %s: **%d new**, **%d fixed**, %d in total.\n\n", baseline.RecordedAt, countIssues(drift.New), fixed, total))
+
+	if len(drift.New) > 0 {
+		out.WriteString("### Regression areas\n\n| Directory | New issues |\n|---|---|\n")
+		for _, area := range regressionAreas(drift.New) {
+			out.WriteString(fmt.Sprintf("| `%s` | %d |\n", area.Dir, area.Count))
+		}
+		out.WriteString("\n### New issues\n\n")
+		renderFileSections(&out, "####", drift.New, report.HeadSHA, config)
+	}
+	if len(drift.Fixed) > 0 {
+		out.WriteString("### Fixed\n\n")
+		filenames := make([]string, 0, len(drift.Fixed))
+		for filename := range drift.Fixed {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
+		for _, filename := range filenames {
+			out.WriteString(fmt.Sprintf("- `%s`: %d issue(s)\n", filename, drift.Fixed[filename]))
+		}
+	}
+	return out.String()
+}
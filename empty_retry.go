@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// EmptyRetryConfig re-prompts once when a large patch comes back with no
+// issues at all, which is more often a formatting slip by the model than a
+// clean patch. Small patches are never retried, so genuinely clean files
+// don't cost an extra call.
+type EmptyRetryConfig struct {
+	Enabled bool `json:"enabled"`
+	// MinChangedLines is the patch size, in added or changed lines, from
+	// which an empty result is retried. Defaults to 50.
+	MinChangedLines int `json:"minChangedLines"`
+}
+
+const defaultEmptyRetryMinChangedLines = 50
+
+const emptyRetryInstructions = `
+
+Your previous answer to this prompt reported no issues. Review the changes again against every rule. Respond only with JSON of the form {"issues": [{"type": "...", "message": "...", "suggestion": "...", "line": 0}]}, using an empty "issues" array only if the changes really follow all the rules.`
+
+func (c EmptyRetryConfig) applies(patch string) bool {
+	if !c.Enabled {
+		return false
+	}
+	threshold := c.MinChangedLines
+	if threshold == 0 {
+		threshold = defaultEmptyRetryMinChangedLines
+	}
+	return addedLineCount(patch) >= threshold
+}
+
+// retryEmpty re-prompts a patch once with stricter instructions. A failed
+// retry keeps the original, empty result.
+func (a *Analyzer) retryEmpty(ctx context.Context, provider LLMProvider, filename, patch, rules string) []Issue {
+	fmt.Fprintf(progress, "  No issues for %s despite its size, retrying once.\n", filename)
+	prompt := buildPrompt(patch, a.Config, rules, a.RepoContext) + emptyRetryInstructions
+	result, err := a.call(ctx, provider, patch, prompt)
+	if err != nil {
+		fmt.Fprintf(progress, "  Retry for %s failed: %v\n", filename, err)
+		return nil
+	}
+	return result.Issues
+}
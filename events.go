@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/google/go-github/v57/github"
+)
+
+// defaultTriggerActions are the pull_request event actions that change the
+// code under review.
+var defaultTriggerActions = []string{"opened", "synchronize", "reopened"}
+
+// eventAction returns the action of the pull request event that started
+// the workflow, e.g. "synchronize", or "" for any other event. Actions of
+// other events, such as a merge group's "checks_requested", aren't
+// filtered by triggerActions.
+func eventAction() string {
+	switch os.Getenv("GITHUB_EVENT_NAME") {
+	case "pull_request", "pull_request_target":
+	default:
+		return ""
+	}
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return ""
+	}
+	return payload.Action
+}
+
+// triggeredBy reports whether the linter should run for an event action.
+// Events without an action always run, and so does a draft being marked
+// ready for review when drafts are skipped or quiet.
+func triggeredBy(action string, config *Config) bool {
+	if action == "" {
+		return true
+	}
+	if action == "ready_for_review" && config.drafts() != draftsAnalyze {
+		return true
+	}
+	allowed := config.TriggerActions
+	if len(allowed) == 0 {
+		allowed = defaultTriggerActions
+	}
+	return slices.Contains(allowed, action)
+}
+
+// isForkPullRequest reports whether the workflow runs for a pull_request
+// event from a fork. GitHub gives such runs a read-only token, so nothing
+// can be posted to the pull request. pull_request_target runs get a token
+// that can write and aren't affected.
+func isForkPullRequest() bool {
+	if os.Getenv("GITHUB_EVENT_NAME") != "pull_request" {
+		return false
+	}
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return false
+	}
+	var payload struct {
+		PullRequest struct {
+			Head struct {
+				Repo struct {
+					FullName string `json:"full_name"`
+				} `json:"repo"`
+			} `json:"head"`
+			Base struct {
+				Repo struct {
+					FullName string `json:"full_name"`
+				} `json:"repo"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return false
+	}
+	head, base := payload.PullRequest.Head.Repo.FullName, payload.PullRequest.Base.Repo.FullName
+	return head != "" && head != base
+}
+
+// slashCommandName triggers an on-demand run from a pull request comment.
+const slashCommandName = "/semantic-lint"
+
+// slashCommandRoles are the author associations allowed to trigger a run,
+// so outside contributors can't spend the AI budget.
+var slashCommandRoles = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// SlashCommand is a "/semantic-lint [glob...]" comment on a pull request.
+type SlashCommand struct {
+	CommentID int64
+	// Globs narrow the run to matching files. Empty means every file.
+	Globs []string
+}
+
+// isCommentEvent reports whether the workflow was started by a comment.
+func isCommentEvent() bool {
+	return os.Getenv("GITHUB_EVENT_NAME") == "issue_comment"
+}
+
+// slashCommandFromEvent returns the command in the comment that started the
+// workflow, or nil when the comment isn't a command the linter should run
+// for: not on a pull request, not new, not starting with the command, or
+// by an author without write access.
+func slashCommandFromEvent() (*SlashCommand, error) {
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event file: %w", err)
+	}
+	var payload struct {
+		Action string `json:"action"`
+		Issue  struct {
+			PullRequest *struct{} `json:"pull_request"`
+		} `json:"issue"`
+		Comment struct {
+			ID                int64  `json:"id"`
+			Body              string `json:"body"`
+			AuthorAssociation string `json:"author_association"`
+		} `json:"comment"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+	if payload.Action != "created" || payload.Issue.PullRequest == nil {
+		return nil, nil
+	}
+
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(payload.Comment.Body), "\n")
+	fields := strings.Fields(firstLine)
+	if len(fields) == 0 || fields[0] != slashCommandName {
+		return nil, nil
+	}
+	if !slices.Contains(slashCommandRoles, payload.Comment.AuthorAssociation) {
+		fmt.Printf("Ignoring %s from a %s.\n", slashCommandName, strings.ToLower(payload.Comment.AuthorAssociation))
+		return nil, nil
+	}
+	for _, glob := range fields[1:] {
+		if !doublestar.ValidatePattern(glob) {
+			return nil, fmt.Errorf("invalid glob %q in %s", glob, slashCommandName)
+		}
+	}
+	return &SlashCommand{CommentID: payload.Comment.ID, Globs: fields[1:]}, nil
+}
+
+// acknowledge reacts to the command comment with 👀 so its author knows the
+// run started.
+func (c *SlashCommand) acknowledge(ctx context.Context, client *github.Client, owner, repo string) error {
+	_, _, err := client.Reactions.CreateIssueCommentReaction(ctx, owner, repo, c.CommentID, "eyes")
+	return err
+}
+
+// filter keeps the files matching the command's globs.
+func (c *SlashCommand) filter(files []*ChangedFile) ([]*ChangedFile, error) {
+	if len(c.Globs) == 0 {
+		return files, nil
+	}
+	var matched []*ChangedFile
+	for _, file := range files {
+		match, err := matchAny(file.Filename, c.Globs)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			matched = append(matched, file)
+		}
+	}
+	return matched, nil
+}
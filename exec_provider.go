@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// ExecProviderConfig configures a provider plugin: an external command that
+// talks to a model the action has no built-in support for.
+//
+// The command receives the full prompt on stdin and must print a single
+// AnalysisResult, {"issues": [...]}, as JSON on stdout. The API key, the
+// model and the output token limit are passed in the environment as
+// SEMANTIC_LINT_API_KEY, SEMANTIC_LINT_MODEL and
+// SEMANTIC_LINT_MAX_OUTPUT_TOKENS. A non-zero exit fails the file; stderr is
+// passed through to the log.
+type ExecProviderConfig struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Model   string   `json:"model"`
+}
+
+type ExecProvider struct {
+	Config          ExecProviderConfig
+	MaxOutputTokens int
+}
+
+func (p *ExecProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	if p.Config.Command == "" {
+		return nil, fmt.Errorf("ai.exec.command is required")
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Config.Command, p.Config.Args...)
+	cmd.Stdin = bytes.NewReader([]byte(prompt))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SEMANTIC_LINT_API_KEY="+apiKey,
+		"SEMANTIC_LINT_MODEL="+p.Config.Model,
+		"SEMANTIC_LINT_MAX_OUTPUT_TOKENS="+strconv.Itoa(p.MaxOutputTokens),
+	)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("provider command %s failed: %w", p.Config.Command, err)
+	}
+
+	decoder := json.NewDecoder(&stdout)
+	decoder.DisallowUnknownFields()
+	var result AnalysisResult
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("provider command %s returned a malformed result: %w", p.Config.Command, err)
+	}
+	return &result, nil
+}
+
+func (p *ExecProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
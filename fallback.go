@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// FallbackProviderConfig names a provider to try when the ones before it in
+// the chain fail. Its settings come from the provider's usual section of the
+// ai config, e.g. ai.openai.
+type FallbackProviderConfig struct {
+	Provider string `json:"provider"`
+	// APIKeyEnv names the environment variable holding this provider's API
+	// key, since it usually differs from the primary provider's. Without it
+	// the primary provider's key is used.
+	APIKeyEnv string `json:"apiKeyEnv"`
+}
+
+// FallbackProvider tries each provider in order until one succeeds, so a
+// provider outage or rate limit doesn't leave files unanalyzed.
+type FallbackProvider struct {
+	Chain []ProviderStep
+}
+
+// ProviderStep is one provider in a fallback chain or consensus group. An
+// empty APIKey means the key passed to Analyze is used.
+type ProviderStep struct {
+	Name     string
+	Provider LLMProvider
+	APIKey   string
+}
+
+func newFallbackProvider(primary LLMProvider, config *Config) (*FallbackProvider, error) {
+	steps, err := newProviderSteps(config.AI.Fallback, config)
+	if err != nil {
+		return nil, fmt.Errorf("ai.fallback: %w", err)
+	}
+	chain := &FallbackProvider{Chain: []ProviderStep{{Name: config.AI.Provider, Provider: primary}}}
+	chain.Chain = append(chain.Chain, steps...)
+	return chain, nil
+}
+
+// newProviderSteps builds the listed providers with their API keys.
+func newProviderSteps(configs []FallbackProviderConfig, config *Config) ([]ProviderStep, error) {
+	var steps []ProviderStep
+	for _, c := range configs {
+		provider, err := newNamedProvider(c.Provider, config)
+		if err != nil {
+			return nil, err
+		}
+		var apiKey string
+		if c.APIKeyEnv != "" {
+			apiKey = os.Getenv(c.APIKeyEnv)
+			if apiKey == "" {
+				return nil, fmt.Errorf("%s for %s is not set", c.APIKeyEnv, c.Provider)
+			}
+		}
+		steps = append(steps, ProviderStep{Name: c.Provider, Provider: provider, APIKey: apiKey})
+	}
+	return steps, nil
+}
+
+func (p *FallbackProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	var errs []error
+	for i, step := range p.Chain {
+		key := step.APIKey
+		if key == "" {
+			key = apiKey
+		}
+		result, err := step.Provider.Analyze(ctx, patch, prompt, key)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", step.Name, err))
+		if i+1 < len(p.Chain) {
+			fmt.Fprintf(progress, "  Provider %s failed (%v), falling back to %s.\n", step.Name, err, p.Chain[i+1].Name)
+		}
+	}
+	return nil, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
+
+// WithModel switches the model of the primary provider only, since model
+// names don't carry over between providers.
+func (p *FallbackProvider) WithModel(model string) LLMProvider {
+	selectable, ok := p.Chain[0].Provider.(ModelSelectable)
+	if !ok {
+		return p
+	}
+	clone := &FallbackProvider{Chain: append([]ProviderStep(nil), p.Chain...)}
+	clone.Chain[0].Provider = selectable.WithModel(model)
+	return clone
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// FeedbackConfig asks reviewers to react to the linter's comments and
+// reports the reactions from earlier runs in the job summary, so rule
+// authors can see which findings are useful.
+type FeedbackConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+const feedbackPrompt = "<sub>Was this useful? React with 👍 or 👎.</sub>"
+
+// reactionCounts are the thumbs reactions on one or more comments.
+type reactionCounts struct {
+	Up, Down int
+}
+
+func (r *reactionCounts) add(reactions *github.Reactions) {
+	r.Up += reactions.GetPlusOne()
+	r.Down += reactions.GetMinusOne()
+}
+
+// collectFeedback reads the reactions on the linter's inline comments, per
+// issue type, and on its previous summary comment.
+func collectFeedback(ctx context.Context, client *github.Client, owner, repo string, prNumber int, previous *github.IssueComment) (map[string]*reactionCounts, *reactionCounts, error) {
+	login, err := tokenLogin(ctx, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	byType := make(map[string]*reactionCounts)
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list review comments: %w", err)
+		}
+		for _, c := range comments {
+			issueType, ok := inlineCommentType(c.GetBody())
+			if !ok || !writtenBy(c.GetUser(), login) {
+				continue
+			}
+			if byType[issueType] == nil {
+				byType[issueType] = &reactionCounts{}
+			}
+			byType[issueType].add(c.GetReactions())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	summary := &reactionCounts{}
+	if previous != nil {
+		summary.add(previous.GetReactions())
+	}
+	return byType, summary, nil
+}
+
+// inlineCommentType returns the issue type recorded in an inline comment's
+// marker.
+func inlineCommentType(body string) (string, bool) {
+	if !strings.HasPrefix(body, inlineMarkerPrefix) {
+		return "", false
+	}
+	rest := body[len(inlineMarkerPrefix):]
+	end := strings.Index(rest, " -->")
+	if end < 0 {
+		return "", false
+	}
+	return rest[:end], true
+}
+
+func renderFeedbackReport(byType map[string]*reactionCounts, summary *reactionCounts) string {
+	var out strings.Builder
+	out.WriteString("### Finding usefulness\n\n")
+	out.WriteString(fmt.Sprintf("Results comment: 👍 %d · 👎 %d\n\n", summary.Up, summary.Down))
+	if len(byType) == 0 {
+		out.WriteString("No reactions on inline comments yet.\n\n")
+		return out.String()
+	}
+
+	types := make([]string, 0, len(byType))
+	for issueType := range byType {
+		types = append(types, issueType)
+	}
+	sort.Strings(types)
+
+	out.WriteString("| Type | 👍 | 👎 |\n| --- | ---: | ---: |\n")
+	for _, issueType := range types {
+		counts := byType[issueType]
+		out.WriteString(fmt.Sprintf("| %s | %d | %d |\n", issueType, counts.Up, counts.Down))
+	}
+	out.WriteString("\n")
+	return out.String()
+}
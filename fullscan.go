@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The mode input picks what is analyzed: the changes of a pull request,
+// push or pair of refs ("pull-request", the default), or every file of the
+// checked-out tree ("full-scan"), e.g. for an adoption audit or a
+// scheduled sweep. "post" analyzes nothing and publishes the results of a
+// pull request run from a fork.
+const (
+	modePullRequest = "pull-request"
+	modeFullScan    = "full-scan"
+	modePost        = "post"
+)
+
+const (
+	defaultChunkLines = 400
+	// maxScanFileBytes skips files too large to be source code worth
+	// sending, such as generated bundles.
+	maxScanFileBytes = 1 << 20
+)
+
+// FullScanConfig controls how files are sent in full-scan mode.
+type FullScanConfig struct {
+	// ChunkLines is how many lines of a file are sent per request. Longer
+	// files are sent in several chunks. Defaults to 400.
+	ChunkLines int `json:"chunkLines"`
+}
+
+func (c FullScanConfig) chunkLines() int {
+	if c.ChunkLines > 0 {
+		return c.ChunkLines
+	}
+	return defaultChunkLines
+}
+
+// scanWorkingTree returns every text file under root as a file whose patch
+// adds its whole content, so it is analyzed like a newly added file. The
+// .git directory, binary files and files over maxScanFileBytes are left out.
+func scanWorkingTree(root string) ([]*ChangedFile, error) {
+	var files []*ChangedFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxScanFileBytes {
+			fmt.Printf("Skipping %s: larger than %d bytes.\n", rel, maxScanFileBytes)
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if len(content) == 0 || bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+			return nil
+		}
+		files = append(files, &ChangedFile{
+			Filename: filepath.ToSlash(rel),
+			Patch:    additionPatch(strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"), 1),
+			Status:   "added",
+		})
+		return nil
+	})
+	return files, err
+}
+
+// additionPatch renders lines as a hunk adding them from line start on.
+func additionPatch(lines []string, start int) string {
+	var patch strings.Builder
+	fmt.Fprintf(&patch, "@@ -0,0 +%d,%d @@\n", start, len(lines))
+	for _, line := range lines {
+		patch.WriteString("+" + line + "\n")
+	}
+	return patch.String()
+}
+
+// chunkFiles splits the whole-file patches of a full scan into chunks of at
+// most size lines. Each chunk keeps its line numbers in the file, and the
+// results of a file's chunks are merged again when aggregated.
+func chunkFiles(files []*ChangedFile, size int) []*ChangedFile {
+	var chunked []*ChangedFile
+	for _, file := range files {
+		_, body, _ := strings.Cut(file.Patch, "\n")
+		lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+		if len(lines) <= size {
+			chunked = append(chunked, file)
+			continue
+		}
+		for start := 0; start < len(lines); start += size {
+			chunk := lines[start:min(start+size, len(lines))]
+			for i, line := range chunk {
+				chunk[i] = strings.TrimPrefix(line, "+")
+			}
+			chunked = append(chunked, &ChangedFile{
+				Filename: file.Filename,
+				Patch:    additionPatch(chunk, start+1),
+				Status:   file.Status,
+			})
+		}
+	}
+	return chunked
+}
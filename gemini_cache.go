@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// RulesCacher is implemented by providers that can upload a rules document
+// once and refer to it from later prompts instead of resending it. Fallback
+// chains and consensus groups implement it for their members.
+type RulesCacher interface {
+	// WithCachedRules returns a provider whose requests refer to the cached
+	// rules instead of carrying them in the prompt, or false when the rules
+	// can't be cached, e.g. because they are below the provider's minimum
+	// cache size.
+	WithCachedRules(ctx context.Context, rules, apiKey string) (LLMProvider, bool)
+	// ReleaseCachedRules deletes the caches created so far.
+	ReleaseCachedRules(ctx context.Context)
+}
+
+// cachedRulesNote stands in for the rules in prompts sent with cached rules.
+const cachedRulesNote = "(The rules are provided in the cached context.)"
+
+// geminiCacheTTL keeps a cache alive for longer than any run should take.
+// Caches are deleted when the analysis ends; the TTL only limits the cost
+// of a run that dies before that.
+const geminiCacheTTL = "3600s"
+
+// geminiRulesCache holds the caches created during a run, keyed by model
+// and rules hash. An empty name records a failed attempt, so it isn't
+// retried for every file. urls holds the API URL of each created cache,
+// for deleting it.
+type geminiRulesCache struct {
+	mu    sync.Mutex
+	names map[string]string
+	urls  []string
+}
+
+// geminiCacheRequest creates a cache. Gemini rejects requests that refer to
+// a cache and also set tools, so with tool calling the report_issues tool
+// is part of the cache.
+type geminiCacheRequest struct {
+	Model      string            `json:"model"`
+	Contents   []GeminiContent   `json:"contents"`
+	Tools      []GeminiTool      `json:"tools,omitempty"`
+	ToolConfig *GeminiToolConfig `json:"toolConfig,omitempty"`
+	TTL        string            `json:"ttl"`
+}
+
+func (p *GeminiProvider) WithCachedRules(ctx context.Context, rules, apiKey string) (LLMProvider, bool) {
+	if p.Config.Vertex != nil || p.rulesCache == nil {
+		return nil, false
+	}
+	model := p.Config.Model
+	if model == "" {
+		match := geminiModelPattern.FindString(p.Config.APIEndpoint)
+		model = strings.TrimSuffix(strings.TrimPrefix(match, "/models/"), ":")
+	}
+	key := model + "@" + contentHash(rules)
+
+	p.rulesCache.mu.Lock()
+	defer p.rulesCache.mu.Unlock()
+	name, tried := p.rulesCache.names[key]
+	if !tried {
+		var err error
+		name, err = p.createRulesCache(ctx, model, rules, apiKey)
+		if err != nil {
+			fmt.Fprintf(progress, "  Could not cache the rules for %s, sending them with every prompt: %v\n", model, err)
+		} else {
+			fmt.Fprintf(progress, "  Cached the rules for %s as %s.\n", model, name)
+		}
+		p.rulesCache.names[key] = name
+	}
+	if name == "" {
+		return nil, false
+	}
+	clone := *p
+	clone.cachedContent, clone.cachedRules = name, rules
+	return &clone, true
+}
+
+// ReleaseCachedRules deletes the caches this provider and its copies for
+// other models created.
+func (p *GeminiProvider) ReleaseCachedRules(ctx context.Context) {
+	if p.rulesCache == nil {
+		return
+	}
+	p.rulesCache.mu.Lock()
+	defer p.rulesCache.mu.Unlock()
+	for _, url := range p.rulesCache.urls {
+		if err := p.deleteRulesCache(ctx, url); err != nil {
+			fmt.Fprintf(progress, "::warning::Could not delete the rules cache, it expires after %s: %v\n", geminiCacheTTL, err)
+		}
+	}
+	p.rulesCache.urls = nil
+}
+
+func (p *GeminiProvider) createRulesCache(ctx context.Context, model, rules, apiKey string) (string, error) {
+	base, query, _ := strings.Cut(p.Config.APIEndpoint, "?")
+	base, _, found := strings.Cut(base, "/models/")
+	if !found || model == "" {
+		return "", fmt.Errorf("can't derive the cache endpoint from %s", p.Config.APIEndpoint)
+	}
+	if query != "" {
+		query = "?" + strings.ReplaceAll(query, "{{AI_API_KEY}}", apiKey)
+	}
+
+	request := geminiCacheRequest{
+		Model:    "models/" + model,
+		Contents: []GeminiContent{{Role: "user", Parts: []GeminiPart{{Text: rules}}}},
+		TTL:      geminiCacheTTL,
+	}
+	if p.Config.ToolCalling {
+		request.Tools, request.ToolConfig = geminiReportIssuesTool()
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/cachedContents"+query, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for key, value := range p.Config.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("status %s: %s", resp.Status, msg)
+	}
+	var created struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", err
+	}
+	p.rulesCache.urls = append(p.rulesCache.urls, base+"/"+created.Name+query)
+	return created.Name, nil
+}
+
+func (p *GeminiProvider) deleteRulesCache(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range p.Config.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// withCachedStepRules returns a copy of steps in which every member that
+// can cache the rules refers to its cache, and whether any does.
+func withCachedStepRules(ctx context.Context, steps []ProviderStep, rules, apiKey string) ([]ProviderStep, bool) {
+	cached := append([]ProviderStep(nil), steps...)
+	found := false
+	for i, step := range cached {
+		cacher, ok := step.Provider.(RulesCacher)
+		if !ok {
+			continue
+		}
+		key := step.APIKey
+		if key == "" {
+			key = apiKey
+		}
+		if provider, ok := cacher.WithCachedRules(ctx, rules, key); ok {
+			cached[i].Provider = provider
+			found = true
+		}
+	}
+	return cached, found
+}
+
+func releaseStepRules(ctx context.Context, steps []ProviderStep) {
+	for _, step := range steps {
+		if cacher, ok := step.Provider.(RulesCacher); ok {
+			cacher.ReleaseCachedRules(ctx)
+		}
+	}
+}
+
+func (p *FallbackProvider) WithCachedRules(ctx context.Context, rules, apiKey string) (LLMProvider, bool) {
+	chain, ok := withCachedStepRules(ctx, p.Chain, rules, apiKey)
+	return &FallbackProvider{Chain: chain}, ok
+}
+
+func (p *FallbackProvider) ReleaseCachedRules(ctx context.Context) {
+	releaseStepRules(ctx, p.Chain)
+}
+
+func (p *ConsensusProvider) WithCachedRules(ctx context.Context, rules, apiKey string) (LLMProvider, bool) {
+	members, ok := withCachedStepRules(ctx, p.Members, rules, apiKey)
+	return &ConsensusProvider{Members: members, Quorum: p.Quorum}, ok
+}
+
+func (p *ConsensusProvider) ReleaseCachedRules(ctx context.Context) {
+	releaseStepRules(ctx, p.Members)
+}
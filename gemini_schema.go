@@ -0,0 +1,43 @@
+package main
+
+// geminiResponseSchema declares the shape of AnalysisResult to Gemini, so
+// with JSON response mode the model returns the result as plain JSON rather
+// than text that has to be cut out of a Markdown fence.
+var geminiResponseSchema = map[string]any{
+	"type": "OBJECT",
+	"properties": map[string]any{
+		"issues": map[string]any{
+			"type": "ARRAY",
+			"items": map[string]any{
+				"type": "OBJECT",
+				"properties": map[string]any{
+					"type":          map[string]any{"type": "STRING"},
+					"message":       map[string]any{"type": "STRING"},
+					"suggestion":    map[string]any{"type": "STRING"},
+					"line":          map[string]any{"type": "INTEGER"},
+					"endLine":       map[string]any{"type": "INTEGER"},
+					"suggestedCode": map[string]any{"type": "STRING"},
+				},
+				"required": []string{"type", "message"},
+			},
+		},
+		"needContext": map[string]any{
+			"type": "ARRAY",
+			"items": map[string]any{
+				"type": "OBJECT",
+				"properties": map[string]any{
+					"path":   map[string]any{"type": "STRING"},
+					"symbol": map[string]any{"type": "STRING"},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	"required": []string{"issues"},
+}
+
+// structuredOutput reports whether to use JSON response mode, which is on
+// unless the config turns it off for a model that lacks it.
+func (c GeminiConfig) structuredOutput() bool {
+	return c.StructuredOutput == nil || *c.StructuredOutput
+}
@@ -0,0 +1,23 @@
+package main
+
+// GenerationParams are sampling settings sent to the model instead of
+// relying on its defaults. A low temperature keeps results consistent
+// between runs. Unset fields are left to the provider; parameters a
+// provider's API lacks, such as topK for OpenAI, are ignored.
+type GenerationParams struct {
+	Temperature *float64 `json:"temperature"`
+	TopP        *float64 `json:"topP"`
+	TopK        *int     `json:"topK"`
+	// MaxOutputTokens overrides ai.maxOutputTokens for this provider.
+	MaxOutputTokens int      `json:"maxOutputTokens"`
+	StopSequences   []string `json:"stopSequences"`
+}
+
+// maxOutputTokens returns the provider's own limit, or fallback when it has
+// none.
+func (g GenerationParams) maxOutputTokens(fallback int) int {
+	if g.MaxOutputTokens > 0 {
+		return g.MaxOutputTokens
+	}
+	return fallback
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// gerritRobotID names the linter as the robot behind its comments.
+const gerritRobotID = "semantic-lint"
+
+// gerritXSSIPrefix starts every JSON response of the Gerrit REST API.
+var gerritXSSIPrefix = []byte(")]}'")
+
+// runGerrit analyzes a revision of a Gerrit change and reports on it with
+// robot comments and a review message. The change and revision default to
+// the variables the Gerrit Trigger plugin sets for a Jenkins build. The
+// config and rules are read from the checkout. It returns the process exit
+// code.
+func runGerrit(args []string) int {
+	cmd := newSubcommand("gerrit")
+	server := cmd.String("url", os.Getenv("SEMANTIC_LINT_GERRIT_URL"), "Gerrit server URL, e.g. https://review.example.com")
+	change := cmd.String("change", os.Getenv("GERRIT_CHANGE_NUMBER"), "change number or ID")
+	revision := cmd.String("revision", os.Getenv("GERRIT_PATCHSET_REVISION"), "revision (commit SHA or patch set number); defaults to the current one")
+	return cmd.review(args, func() (ReviewHost, error) {
+		return newGerritHost(*server, *change, *revision, os.Getenv("SEMANTIC_LINT_GERRIT_USER"), os.Getenv("SEMANTIC_LINT_GERRIT_PASSWORD"))
+	})
+}
+
+// gerritHost is a revision of a Gerrit change, reached through the
+// authenticated REST API. Robot comments are collected and posted together
+// with the summary as one review.
+type gerritHost struct {
+	client   *http.Client
+	baseURL  string
+	user     string
+	password string
+	// revision is the revision's path, below the API root.
+	revision string
+	runID    string
+
+	existing map[string]bool
+	pending  map[string][]gerritRobotComment
+}
+
+// newGerritHost checks the change's coordinates. The password is the
+// user's HTTP password from the Gerrit settings.
+func newGerritHost(server, change, revision, user, password string) (*gerritHost, error) {
+	switch {
+	case server == "":
+		return nil, fmt.Errorf("-url or SEMANTIC_LINT_GERRIT_URL is required")
+	case change == "":
+		return nil, fmt.Errorf("-change is required outside a Gerrit Trigger build")
+	case user == "" || password == "":
+		return nil, fmt.Errorf("SEMANTIC_LINT_GERRIT_USER and SEMANTIC_LINT_GERRIT_PASSWORD are not set")
+	}
+	if revision == "" {
+		revision = "current"
+	}
+	return &gerritHost{
+		client:   http.DefaultClient,
+		baseURL:  strings.TrimSuffix(server, "/") + "/a",
+		user:     user,
+		password: password,
+		revision: fmt.Sprintf("/changes/%s/revisions/%s", url.PathEscape(change), url.PathEscape(revision)),
+		runID:    time.Now().UTC().Format(time.RFC3339),
+		pending:  make(map[string][]gerritRobotComment),
+	}, nil
+}
+
+// do sends a request to a path below the revision and decodes the JSON
+// response into out, unless out is nil. The raw response body is returned
+// too.
+func (h *gerritHost) do(ctx context.Context, method, path string, body, out any) ([]byte, error) {
+	data, _, err := hostRequest(ctx, h.client, method, h.baseURL+h.revision+path, body, func(req *http.Request) {
+		req.SetBasicAuth(h.user, h.password)
+	})
+	if err != nil || out == nil {
+		return data, err
+	}
+	return data, json.Unmarshal(bytes.TrimPrefix(data, gerritXSSIPrefix), out)
+}
+
+// ChangedFiles returns the files the revision changes against its parent,
+// from the revision's patch in git format.
+func (h *gerritHost) ChangedFiles(ctx context.Context) ([]*ChangedFile, error) {
+	encoded, err := h.do(ctx, http.MethodGet, "/patch", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision patch: %w", err)
+	}
+	patch, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode revision patch: %w", err)
+	}
+	// Drop the "-- " signature format-patch ends with, so it isn't read as
+	// lines of the last file's patch.
+	text := string(patch)
+	if i := strings.LastIndex(text, "\n-- \n"); i >= 0 {
+		text = text[:i+1]
+	}
+	return parseGitDiff(text), nil
+}
+
+// AddedLines returns the added and context lines of each file. Gerrit
+// places a comment on any line of the revision.
+func (h *gerritHost) AddedLines(files []*ChangedFile) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool, len(files))
+	for _, file := range files {
+		lines[file.Filename] = commentableLines(file.Patch)
+	}
+	return lines
+}
+
+type gerritRange struct {
+	StartLine      int `json:"start_line"`
+	StartCharacter int `json:"start_character"`
+	EndLine        int `json:"end_line"`
+	EndCharacter   int `json:"end_character"`
+}
+
+type gerritReplacement struct {
+	Path        string      `json:"path"`
+	Range       gerritRange `json:"range"`
+	Replacement string      `json:"replacement"`
+}
+
+type gerritFixSuggestion struct {
+	Description  string              `json:"description"`
+	Replacements []gerritReplacement `json:"replacements"`
+}
+
+type gerritRobotComment struct {
+	RobotID        string                `json:"robot_id"`
+	RobotRunID     string                `json:"robot_run_id"`
+	Line           int                   `json:"line,omitempty"`
+	Message        string                `json:"message"`
+	Properties     map[string]string     `json:"properties,omitempty"`
+	FixSuggestions []gerritFixSuggestion `json:"fix_suggestions,omitempty"`
+}
+
+// PostLineComment queues a robot comment for the review PostSummary posts.
+// The issue's severity and type are recorded as properties, and suggested
+// code becomes a fix the author can apply. Comments the linter already
+// left on the revision are skipped.
+func (h *gerritHost) PostLineComment(ctx context.Context, comment LineComment) error {
+	if h.existing == nil {
+		var existing map[string][]struct {
+			RobotID string `json:"robot_id"`
+			Line    int    `json:"line"`
+			Message string `json:"message"`
+		}
+		if _, err := h.do(ctx, http.MethodGet, "/robotcomments", nil, &existing); err != nil {
+			return fmt.Errorf("failed to list robot comments: %w", err)
+		}
+		h.existing = make(map[string]bool)
+		for path, comments := range existing {
+			for _, c := range comments {
+				if c.RobotID == gerritRobotID {
+					h.existing[lineCommentKey(path, c.Line, c.Message)] = true
+				}
+			}
+		}
+	}
+
+	issue := comment.Issue
+	message := fmt.Sprintf("%s: %s", issue.Type, issue.Message)
+	if issue.Suggestion != "" {
+		message += "\n\nSuggestion: " + issue.Suggestion
+	}
+	if h.existing[lineCommentKey(comment.Filename, issue.Line, message)] {
+		return nil
+	}
+	robot := gerritRobotComment{
+		RobotID:    gerritRobotID,
+		RobotRunID: h.runID,
+		Line:       issue.Line,
+		Message:    message,
+		Properties: map[string]string{"severity": comment.Severity, "type": issue.Type},
+	}
+	if issue.SuggestedCode != "" {
+		// The replacement covers the issue's lines up to the start of the
+		// line after them.
+		robot.FixSuggestions = []gerritFixSuggestion{{
+			Description: "Apply the suggested code",
+			Replacements: []gerritReplacement{{
+				Path:        comment.Filename,
+				Range:       gerritRange{StartLine: issue.Line, EndLine: max(issue.Line, issue.EndLine) + 1},
+				Replacement: issue.SuggestedCode + "\n",
+			}},
+		}}
+	}
+	h.pending[comment.Filename] = append(h.pending[comment.Filename], robot)
+	h.existing[lineCommentKey(comment.Filename, issue.Line, message)] = true
+	return nil
+}
+
+// PostSummary posts a review with the summary as its message and the
+// queued robot comments. Gerrit shows the message as plain text, so the
+// hidden markers and state are removed.
+func (h *gerritHost) PostSummary(ctx context.Context, body string, clean bool) error {
+	if body == "" && len(h.pending) == 0 {
+		return nil
+	}
+	review := map[string]any{
+		// The autogenerated tag lets reviewers hide the linter's messages.
+		"tag":     "autogenerated:" + gerritRobotID,
+		"message": stripHiddenData(body),
+	}
+	if len(h.pending) > 0 {
+		review["robot_comments"] = h.pending
+	}
+	if _, err := h.do(ctx, http.MethodPost, "/review", review, nil); err != nil {
+		return fmt.Errorf("failed to post review: %w", err)
+	}
+	h.pending = make(map[string][]gerritRobotComment)
+	return nil
+}
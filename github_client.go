@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// defaultAPIURL is the REST API of github.com, which the client talks to
+// unless configured otherwise.
+const defaultAPIURL = "https://api.github.com"
+
+// withAPIURLs points the client at the REST API of a GitHub Enterprise
+// Server instance: the api-url input, or GITHUB_API_URL, which runners set
+// to the API of the instance they run on. The upload URL is the upload-url
+// input or the instance's default.
+func withAPIURLs(client *github.Client) (*github.Client, error) {
+	apiURL := os.Getenv("INPUT_API-URL")
+	if apiURL == "" {
+		apiURL = os.Getenv("GITHUB_API_URL")
+	}
+	apiURL = strings.TrimSuffix(apiURL, "/")
+	if apiURL == "" || apiURL == defaultAPIURL {
+		return client, nil
+	}
+	uploadURL := os.Getenv("INPUT_UPLOAD-URL")
+	if uploadURL == "" {
+		// WithEnterpriseURLs adds /api/uploads to the instance's root.
+		uploadURL = strings.TrimSuffix(apiURL, "/api/v3")
+	}
+	return client.WithEnterpriseURLs(apiURL, uploadURL)
+}
+
+// appInstallationToken authenticates as a GitHub App and returns an access
+// token for its installation, so the run acts as the app's bot. Without an
+// installation ID the installation on owner/repo is used. The token is
+// valid for an hour.
+func appInstallationToken(ctx context.Context, appID, privateKey, installationID, owner, repo string) (string, error) {
+	key, err := parseAppPrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	assertion, err := appJWT(appID, key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	appClient, err := withAPIURLs(github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: assertion}))))
+	if err != nil {
+		return "", err
+	}
+
+	var id int64
+	if installationID != "" {
+		id, err = strconv.ParseInt(installationID, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid installation ID %q", installationID)
+		}
+	} else {
+		installation, _, err := appClient.Apps.FindRepositoryInstallation(ctx, owner, repo)
+		if err != nil {
+			return "", fmt.Errorf("failed to find the app's installation on %s/%s: %w", owner, repo, err)
+		}
+		id = installation.GetID()
+	}
+	token, _, err := appClient.Apps.CreateInstallationToken(ctx, id, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create an installation token: %w", err)
+	}
+	return token.GetToken(), nil
+}
+
+// parseAppPrivateKey reads the PEM private key GitHub generates for an app
+// (PKCS #1), or the same key converted to PKCS #8.
+func parseAppPrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, fmt.Errorf("app private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("app private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// appJWT signs the RS256 JSON Web Token an app authenticates with. It is
+// issued a minute in the past against clock drift and expires before
+// GitHub's ten-minute limit.
+func appJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss": appID,
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// tokenLogins caches tokenLogin per client.
+var tokenLogins sync.Map
+
+// tokenLogin returns the login the client's token acts as: a user for a
+// personal access token, a bot such as github-actions for an installation
+// token. The linter only trusts and changes comments that login wrote,
+// since anyone who can comment can copy its hidden markers. GraphQL's
+// viewer is used because the REST API's /user rejects installation tokens.
+func tokenLogin(ctx context.Context, client *github.Client) (string, error) {
+	if login, ok := tokenLogins.Load(client); ok {
+		return login.(string), nil
+	}
+	var data struct {
+		Viewer struct {
+			Login string `json:"login"`
+		} `json:"viewer"`
+	}
+	if err := runGraphQL(ctx, client, `query { viewer { login } }`, nil, &data); err != nil {
+		return "", fmt.Errorf("failed to look up the token's login: %w", err)
+	}
+	if data.Viewer.Login == "" {
+		return "", fmt.Errorf("failed to look up the token's login: empty response")
+	}
+	tokenLogins.Store(client, data.Viewer.Login)
+	return data.Viewer.Login, nil
+}
+
+// writtenBy reports whether user is login. The REST API gives bots a
+// "[bot]" suffix GraphQL leaves out.
+func writtenBy(user *github.User, login string) bool {
+	return user.GetLogin() == login || (user.GetType() == "Bot" && user.GetLogin() == login+"[bot]")
+}
+
+// listOwnIssueComments returns the comments on the pull request written
+// with the client's token, following pagination.
+func listOwnIssueComments(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*github.IssueComment, error) {
+	login, err := tokenLogin(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := listIssueComments(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(comments, func(c *github.IssueComment) bool {
+		return !writtenBy(c.GetUser(), login)
+	}), nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// runGitHub analyzes a GitHub pull request from a CI system other than
+// GitHub Actions, such as Jenkins, and reports on it with a review and a
+// summary comment. The repository defaults to GITHUB_REPOSITORY. The config
+// and rules are read from the checkout. It returns the process exit code.
+func runGitHub(args []string) int {
+	cmd := newSubcommand("github")
+	repository := cmd.String("repo", os.Getenv("GITHUB_REPOSITORY"), "repository as owner/name")
+	pullRequest := cmd.Int("pr", 0, "pull request number")
+	return cmd.review(args, func() (ReviewHost, error) {
+		return newGitHubHost(*repository, *pullRequest, os.Getenv("SEMANTIC_LINT_GITHUB_TOKEN"))
+	})
+}
+
+// githubHost is a GitHub pull request as a ReviewHost. Line comments are
+// collected and posted together as one review, like the Action does.
+type githubHost struct {
+	client   *github.Client
+	owner    string
+	repo     string
+	prNumber int
+
+	comments []*github.DraftReviewComment
+	existing map[string]bool
+}
+
+// newGitHubHost reaches the pull request through the API at GITHUB_API_URL,
+// or github.com, with a token that can write pull requests.
+func newGitHubHost(repository string, prNumber int, token string) (*githubHost, error) {
+	owner, repo, ok := strings.Cut(repository, "/")
+	switch {
+	case !ok || owner == "" || repo == "":
+		return nil, fmt.Errorf("-repo must be owner/name, not %q", repository)
+	case prNumber <= 0:
+		return nil, fmt.Errorf("-pr is not set")
+	case token == "":
+		return nil, fmt.Errorf("SEMANTIC_LINT_GITHUB_TOKEN is not set")
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	client, err := withAPIURLs(github.NewClient(oauth2.NewClient(context.Background(), ts)))
+	if err != nil {
+		return nil, fmt.Errorf("GITHUB_API_URL: %w", err)
+	}
+	return &githubHost{client: client, owner: owner, repo: repo, prNumber: prNumber}, nil
+}
+
+func (h *githubHost) ChangedFiles(ctx context.Context) ([]*ChangedFile, error) {
+	files, _, err := getChangedFiles(ctx, h.client, h.owner, h.repo, h.prNumber)
+	return files, err
+}
+
+// AddedLines returns the lines of each file's patch. GitHub places comments
+// on context lines too.
+func (h *githubHost) AddedLines(files []*ChangedFile) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool, len(files))
+	for _, file := range files {
+		lines[file.Filename] = commentableLines(file.Patch)
+	}
+	return lines
+}
+
+// PostLineComment adds the comment to the review PostSummary posts, unless
+// the pull request already has it.
+func (h *githubHost) PostLineComment(ctx context.Context, comment LineComment) error {
+	if h.existing == nil {
+		h.existing = make(map[string]bool)
+		opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			comments, resp, err := h.client.PullRequests.ListComments(ctx, h.owner, h.repo, h.prNumber, opts)
+			if err != nil {
+				return fmt.Errorf("failed to list review comments: %w", err)
+			}
+			for _, c := range comments {
+				h.existing[lineCommentKey(c.GetPath(), c.GetLine(), c.GetBody())] = true
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+	if h.existing[lineCommentKey(comment.Filename, comment.Issue.Line, comment.Body)] {
+		return nil
+	}
+	h.comments = append(h.comments, &github.DraftReviewComment{
+		Path: github.String(comment.Filename),
+		Line: github.Int(comment.Issue.Line),
+		Side: github.String("RIGHT"),
+		Body: github.String(comment.Body),
+	})
+	return nil
+}
+
+func (h *githubHost) PreviousSummary(ctx context.Context) (string, error) {
+	previous, err := findSummaryComment(ctx, h.client, h.owner, h.repo, h.prNumber)
+	return previous.GetBody(), err
+}
+
+// PostSummary posts the collected line comments as a review, then edits the
+// summary comment of an earlier run or adds one.
+func (h *githubHost) PostSummary(ctx context.Context, body string, clean bool) error {
+	if len(h.comments) > 0 {
+		review := &github.PullRequestReviewRequest{Event: github.String(reviewEventComment), Comments: h.comments}
+		if _, _, err := h.client.PullRequests.CreateReview(ctx, h.owner, h.repo, h.prNumber, review); err != nil {
+			return fmt.Errorf("failed to post review: %w", err)
+		}
+	}
+	if body == "" {
+		return nil
+	}
+	previous, err := findSummaryComment(ctx, h.client, h.owner, h.repo, h.prNumber)
+	if err != nil {
+		return err
+	}
+	comment := &github.IssueComment{Body: github.String(truncate(body, maxCommentLength))}
+	if previous != nil {
+		_, _, err = h.client.Issues.EditComment(ctx, h.owner, h.repo, previous.GetID(), comment)
+		return err
+	}
+	_, _, err = h.client.Issues.CreateComment(ctx, h.owner, h.repo, h.prNumber, comment)
+	return err
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// runGitLab analyzes the merge request of a GitLab CI merge request
+// pipeline and reports on it with discussions and a summary note. The
+// config and rules are read from the checkout. It returns the process exit
+// code.
+func runGitLab(args []string) int {
+	return newSubcommand("gitlab").review(args, func() (ReviewHost, error) {
+		return gitLabHostFromEnv()
+	})
+}
+
+// gitLabHost is a GitLab merge request, reached through the REST API.
+type gitLabHost struct {
+	client  *http.Client
+	baseURL string
+	token   string
+	// project is the URL-escaped project ID and mr the merge request's IID.
+	project string
+	mr      string
+
+	diffRefs *gitLabDiffRefs
+	existing map[string]bool
+	// userID is the token's user, whose notes are the linter's.
+	userID int64
+}
+
+// gitLabHostFromEnv reads the merge request from the predefined variables
+// of a merge request pipeline. Job tokens can't post notes, so the API
+// token comes from SEMANTIC_LINT_GITLAB_TOKEN, a project or personal access
+// token with the api scope.
+func gitLabHostFromEnv() (*gitLabHost, error) {
+	host := &gitLabHost{
+		client:  http.DefaultClient,
+		baseURL: strings.TrimSuffix(os.Getenv("CI_API_V4_URL"), "/"),
+		token:   os.Getenv("SEMANTIC_LINT_GITLAB_TOKEN"),
+		project: url.PathEscape(os.Getenv("CI_PROJECT_ID")),
+		mr:      os.Getenv("CI_MERGE_REQUEST_IID"),
+	}
+	switch {
+	case host.baseURL == "" || host.project == "":
+		return nil, fmt.Errorf("CI_API_V4_URL and CI_PROJECT_ID are not set; run in GitLab CI")
+	case host.mr == "":
+		return nil, fmt.Errorf("CI_MERGE_REQUEST_IID is not set; run in a merge request pipeline")
+	case host.token == "":
+		return nil, fmt.Errorf("SEMANTIC_LINT_GITLAB_TOKEN is not set")
+	}
+	return host, nil
+}
+
+// do sends a request to the API and decodes the JSON response into out,
+// unless out is nil. It returns the response headers for pagination.
+func (h *gitLabHost) do(ctx context.Context, method, path string, body, out any) (http.Header, error) {
+	data, header, err := hostRequest(ctx, h.client, method, h.baseURL+path, body, func(req *http.Request) {
+		req.Header.Set("PRIVATE-TOKEN", h.token)
+	})
+	if err != nil || out == nil {
+		return header, err
+	}
+	return header, json.Unmarshal(data, out)
+}
+
+// gitLabList fetches every page of a list endpoint.
+func gitLabList[T any](ctx context.Context, h *gitLabHost, path string) ([]T, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	var all []T
+	for page := "1"; page != ""; {
+		var items []T
+		header, err := h.do(ctx, http.MethodGet, path+separator+"per_page=100&page="+page, nil, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		page = header.Get("X-Next-Page")
+	}
+	return all, nil
+}
+
+func (h *gitLabHost) mrPath() string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%s", h.project, h.mr)
+}
+
+type gitLabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+// ChangedFiles lists the merge request's diffs. GitLab's diffs are the hunks
+// of a unified diff like GitHub's patches; binary files and diffs too large
+// for GitLab to show have none and are left out.
+func (h *gitLabHost) ChangedFiles(ctx context.Context) ([]*ChangedFile, error) {
+	diffs, err := gitLabList[gitLabDiff](ctx, h, h.mrPath()+"/diffs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list merge request diffs: %w", err)
+	}
+	files := make([]*ChangedFile, 0, len(diffs))
+	for _, diff := range diffs {
+		if !strings.HasPrefix(diff.Diff, "@@") {
+			continue
+		}
+		file := &ChangedFile{Filename: diff.NewPath, Patch: strings.TrimSuffix(diff.Diff, "\n"), Status: "modified"}
+		switch {
+		case diff.NewFile:
+			file.Status = "added"
+		case diff.DeletedFile:
+			file.Status = "removed"
+			file.Filename = diff.OldPath
+		case diff.RenamedFile:
+			file.Status = "renamed"
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// AddedLines returns the added lines of each file. GitLab places a comment
+// on a context line only with its old line number too, which the patch
+// parser doesn't track, so context lines are left out.
+func (h *gitLabHost) AddedLines(files []*ChangedFile) map[string]map[int]bool {
+	added := make(map[string]map[int]bool, len(files))
+	for _, file := range files {
+		lines := make(map[int]bool)
+		for _, line := range parsePatch(file.Patch) {
+			if line.Added {
+				lines[line.NewLine] = true
+			}
+		}
+		added[file.Filename] = lines
+	}
+	return added
+}
+
+type gitLabDiffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	StartSHA string `json:"start_sha"`
+	HeadSHA  string `json:"head_sha"`
+}
+
+type gitLabNote struct {
+	ID     int64  `json:"id"`
+	Body   string `json:"body"`
+	Author struct {
+		ID int64 `json:"id"`
+	} `json:"author"`
+	Position *struct {
+		NewPath string `json:"new_path"`
+		NewLine int    `json:"new_line"`
+	} `json:"position"`
+}
+
+type gitLabDiscussion struct {
+	Notes []gitLabNote `json:"notes"`
+}
+
+func lineCommentKey(filename string, line int, body string) string {
+	return fmt.Sprintf("%s\x00%d\x00%s", filename, line, body)
+}
+
+// PostLineComment starts a discussion on a line of the merge request's
+// latest version. The diff refs and the existing discussions are fetched
+// with the first comment.
+func (h *gitLabHost) PostLineComment(ctx context.Context, comment LineComment) error {
+	filename, line, body := comment.Filename, comment.Issue.Line, comment.Body
+	if h.diffRefs == nil {
+		var mr struct {
+			DiffRefs gitLabDiffRefs `json:"diff_refs"`
+		}
+		if _, err := h.do(ctx, http.MethodGet, h.mrPath(), nil, &mr); err != nil {
+			return fmt.Errorf("failed to get merge request: %w", err)
+		}
+		discussions, err := gitLabList[gitLabDiscussion](ctx, h, h.mrPath()+"/discussions")
+		if err != nil {
+			return fmt.Errorf("failed to list discussions: %w", err)
+		}
+		h.existing = make(map[string]bool)
+		for _, discussion := range discussions {
+			for _, note := range discussion.Notes {
+				if note.Position != nil {
+					h.existing[lineCommentKey(note.Position.NewPath, note.Position.NewLine, note.Body)] = true
+				}
+			}
+		}
+		h.diffRefs = &mr.DiffRefs
+	}
+	if h.existing[lineCommentKey(filename, line, body)] {
+		return nil
+	}
+
+	discussion := map[string]any{
+		"body": body,
+		"position": map[string]any{
+			"position_type": "text",
+			"base_sha":      h.diffRefs.BaseSHA,
+			"start_sha":     h.diffRefs.StartSHA,
+			"head_sha":      h.diffRefs.HeadSHA,
+			"new_path":      filename,
+			"new_line":      line,
+		},
+	}
+	if _, err := h.do(ctx, http.MethodPost, h.mrPath()+"/discussions", discussion, nil); err != nil {
+		return fmt.Errorf("failed to comment on %s:%d: %w", filename, line, err)
+	}
+	h.existing[lineCommentKey(filename, line, body)] = true
+	return nil
+}
+
+// summaryNote returns the note that starts with the summary marker, or nil
+// when no earlier run left one. Only the token's user's notes count, so no
+// one else can plant results for the run to reuse.
+func (h *gitLabHost) summaryNote(ctx context.Context) (*gitLabNote, error) {
+	if h.userID == 0 {
+		var user struct {
+			ID int64 `json:"id"`
+		}
+		if _, err := h.do(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+			return nil, fmt.Errorf("failed to look up the token's user: %w", err)
+		}
+		h.userID = user.ID
+	}
+	notes, err := gitLabList[gitLabNote](ctx, h, h.mrPath()+"/notes?sort=asc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	for i := range notes {
+		if notes[i].Author.ID == h.userID && strings.HasPrefix(notes[i].Body, summaryMarker) {
+			return &notes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// PreviousSummary returns the summary note, whose hidden state GitLab
+// keeps.
+func (h *gitLabHost) PreviousSummary(ctx context.Context) (string, error) {
+	note, err := h.summaryNote(ctx)
+	if note == nil {
+		return "", err
+	}
+	return note.Body, nil
+}
+
+// PostSummary edits the summary note, or adds one when no earlier run left
+// one.
+func (h *gitLabHost) PostSummary(ctx context.Context, body string, clean bool) error {
+	if body == "" {
+		return nil
+	}
+	existing, err := h.summaryNote(ctx)
+	if err != nil {
+		return err
+	}
+	note := map[string]string{"body": body}
+	if existing != nil {
+		_, err := h.do(ctx, http.MethodPut, fmt.Sprintf("%s/notes/%d", h.mrPath(), existing.ID), note, nil)
+		return err
+	}
+	_, err = h.do(ctx, http.MethodPost, h.mrPath()+"/notes", note, nil)
+	return err
+}
@@ -5,4 +5,5 @@ go 1.21
 require (
 	github.com/bmatcuk/doublestar/v4 v4.6.0
 	github.com/google/go-github/v57 v57.0.0
+	gopkg.in/yaml.v3 v3.0.1
 )
\ No newline at end of file
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// runGraphQL sends a GraphQL query or mutation with the client's
+// credentials and decodes its data into out, which may be nil.
+func runGraphQL(ctx context.Context, client *github.Client, query string, variables map[string]any, out any) error {
+	body := map[string]any{"query": query, "variables": variables}
+	req, err := client.NewRequest("POST", graphQLURL(client), body)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql: %s", resp.Errors[0].Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// graphQLURL returns the GraphQL endpoint next to the client's REST base
+// URL: /graphql on github.com, /api/graphql on GitHub Enterprise Server.
+func graphQLURL(client *github.Client) string {
+	base := *client.BaseURL
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		base.Path = strings.TrimSuffix(base.Path, "v3/") + "graphql"
+	} else {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/graphql"
+	}
+	return base.String()
+}
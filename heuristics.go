@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// HeuristicsConfig holds deterministic checks that run on the changed file
+// list without the model.
+type HeuristicsConfig struct {
+	RequireTests RequireTestsConfig `json:"requireTests"`
+}
+
+// RequireTestsConfig flags pull requests that change source files without
+// changing any test file.
+type RequireTestsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Type is the issue type reported. Defaults to "missing-tests".
+	Type string `json:"type"`
+	// Severity is "error" or "warning". Defaults to "warning".
+	Severity string `json:"severity"`
+	// TestPatterns are globs recognizing test files. Defaults to
+	// defaultTestPatterns.
+	TestPatterns []string `json:"testPatterns"`
+}
+
+var defaultTestPatterns = []string{
+	"**/*_test.go",
+	"**/*.test.*",
+	"**/*.spec.*",
+	"**/test_*.py",
+	"**/*_test.py",
+	"**/test/**",
+	"**/tests/**",
+	"**/__tests__/**",
+}
+
+// pullRequestResultName is the filename under which issues about the pull
+// request as a whole are reported. They are shown in the summary and the
+// check run's text, but not where a real file is needed.
+const pullRequestResultName = "(pull request)"
+
+// fileResults returns results without the pull request's own issues, for
+// the outputs that locate issues in files: SARIF, annotations and per-file
+// comments.
+func fileResults(results []*FileAnalysisResult) []*FileAnalysisResult {
+	return slices.DeleteFunc(slices.Clone(results), func(result *FileAnalysisResult) bool {
+		return result.Filename == pullRequestResultName
+	})
+}
+
+// checkRequireTests returns a pull-request-level issue when source files
+// changed but no test file did, and nil otherwise. Source files are those
+// in a language detectLanguage knows.
+func checkRequireTests(files []*ChangedFile, config RequireTestsConfig) ([]*FileAnalysisResult, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	patterns := config.TestPatterns
+	if len(patterns) == 0 {
+		patterns = defaultTestPatterns
+	}
+
+	sourceChanged := 0
+	for _, file := range files {
+		isTest, err := matchAny(file.Filename, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if isTest {
+			return nil, nil
+		}
+		if detectLanguage(file.Filename) != "" {
+			sourceChanged++
+		}
+	}
+	if sourceChanged == 0 {
+		return nil, nil
+	}
+
+	issueType := config.Type
+	if issueType == "" {
+		issueType = "missing-tests"
+	}
+	severity := config.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+	return []*FileAnalysisResult{{
+		Filename: pullRequestResultName,
+		Issues: []Issue{{
+			Type:       issueType,
+			Severity:   severity,
+			Message:    fmt.Sprintf("%d source file(s) changed but no test files did.", sourceChanged),
+			Suggestion: "Add or update tests covering the change.",
+		}},
+	}}, nil
+}
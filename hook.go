@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runHook analyzes the staged changes, for use as a pre-commit hook, or
+// with -range the commits about to be pushed, for a pre-push hook. It stops
+// at the first file with an error-severity issue and returns 1, so the
+// commit or push is blocked without waiting for the rest. Results are
+// cached per blob, so running it again on files that haven't changed since
+// costs no provider calls.
+func runHook(args []string) int {
+	cmd := newSubcommand("hook")
+	commitRange := cmd.String("range", "", `analyze a commit range such as "@{push}..HEAD" instead of the staged changes; "-" reads the refs a pre-push hook gets on stdin`)
+	return cmd.run(args, func(ctx context.Context) int {
+		return hook(ctx, *cmd.configPath, *cmd.rulesPath, *commitRange)
+	})
+}
+
+// hook analyzes the changes hookDiff returns for commitRange.
+func hook(ctx context.Context, configPath, rulesPath, commitRange string) int {
+	diff, err := hookDiff(ctx, commitRange)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading changes: %v\n", err)
+		return 1
+	}
+	cacheDir, err := gitOutput(ctx, "rev-parse", "--git-path", "semantic-lint-cache")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locating the git directory: %v\n", err)
+		return 1
+	}
+	cache := &blobCache{dir: strings.TrimSpace(cacheDir), salt: hookCacheSalt(configPath, rulesPath)}
+
+	analyzer, err := newLocalAnalyzer(configPath, rulesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	config := analyzer.Config
+	files, err := filterFiles(parseGitDiff(diff), config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering files: %v\n", err)
+		return 1
+	}
+	files = filterSmallPatches(files, config.Limits)
+	if config.PackageConfigs {
+		analyzer.Packages, err = discoverPackageConfigs(files, configPath, readLocalFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading package configs: %v\n", err)
+			return 1
+		}
+	}
+
+	report := &Report{TotalFiles: len(files)}
+	for _, file := range files {
+		if file.Status == "removed" {
+			continue
+		}
+		// A package config applies to the file too, so it is part of the
+		// key.
+		key := file.SHA
+		if pkg := analyzer.packageFor(file.Filename); pkg != nil && key != "" {
+			key += contentHash(pkg.rules + "\x00" + pkg.Instructions)
+		}
+		result, ok := cache.get(key)
+		if !ok {
+			fileReport := analyzer.AnalyzeFiles(ctx, []*ChangedFile{file})
+			if fileReport.Interrupted {
+				report.Interrupted = true
+				break
+			}
+			if len(fileReport.Failed) > 0 {
+				report.Failed = append(report.Failed, file.Filename)
+				continue
+			}
+			result = fileReport.Results[0]
+			if err := cache.put(key, result); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: could not cache results for %s: %v\n", file.Filename, err)
+			}
+		}
+		report.Results = append(report.Results, result)
+		if hasErrors([]*FileAnalysisResult{result}, config) {
+			break
+		}
+	}
+
+	printTerminalReport(report, config)
+	if hasErrors(report.Results, config) || len(report.Failed) > 0 || report.Interrupted {
+		return 1
+	}
+	return 0
+}
+
+// hookDiffFlags make git diff print blob SHAs in full, which key the cache.
+var hookDiffFlags = []string{"--no-color", "--no-ext-diff", "--full-index"}
+
+// emptyTreeSHA is git's empty tree, the base of a root commit.
+const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// hookDiff returns the changes the hook analyzes: the staged changes, the
+// given commit range, or for "-" the commits of the refs listed on stdin.
+func hookDiff(ctx context.Context, commitRange string) (string, error) {
+	switch commitRange {
+	case "":
+		return gitOutput(ctx, append([]string{"diff", "--cached"}, hookDiffFlags...)...)
+	case "-":
+		return prePushDiff(ctx, os.Stdin)
+	}
+	return gitOutput(ctx, append(append([]string{"diff"}, hookDiffFlags...), commitRange)...)
+}
+
+// prePushDiff diffs the refs git passes a pre-push hook, one per line as
+// "<local ref> <local sha> <remote ref> <remote sha>". A deleted ref has
+// nothing to analyze. A new branch has no remote commit and is diffed from
+// its first commit that isn't on any remote.
+func prePushDiff(ctx context.Context, r io.Reader) (string, error) {
+	var diff strings.Builder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || isZeroSHA(fields[1]) {
+			continue
+		}
+		local, base := fields[1], fields[3]
+		if isZeroSHA(base) {
+			commits, err := gitOutput(ctx, "rev-list", "--reverse", local, "--not", "--remotes")
+			if err != nil {
+				return "", err
+			}
+			first, _, _ := strings.Cut(commits, "\n")
+			if first == "" {
+				continue
+			}
+			base = emptyTreeSHA
+			if parent, err := gitOutput(ctx, "rev-parse", "--verify", "--quiet", first+"^"); err == nil {
+				base = strings.TrimSpace(parent)
+			}
+		}
+		out, err := gitOutput(ctx, append(append([]string{"diff"}, hookDiffFlags...), base, local)...)
+		if err != nil {
+			return "", err
+		}
+		diff.WriteString(out)
+	}
+	return diff.String(), scanner.Err()
+}
+
+// hookCacheSalt ties cached results to the config and rules they were
+// produced with, so editing either invalidates the cache.
+func hookCacheSalt(configPath, rulesPath string) string {
+	config, _ := readLocalFile(configPath)
+	rules, _ := readLocalFile(rulesPath)
+	return contentHash(config + "\x00" + rules)
+}
+
+// blobCache stores the results for a file version, keyed by its blob SHA,
+// as a JSON file per blob.
+type blobCache struct {
+	dir  string
+	salt string
+}
+
+func (c *blobCache) path(sha string) string {
+	return filepath.Join(c.dir, contentHash(c.salt+sha)+".json")
+}
+
+func (c *blobCache) get(sha string) (*FileAnalysisResult, bool) {
+	if sha == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(sha))
+	if err != nil {
+		return nil, false
+	}
+	var result FileAnalysisResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+	return &result, true
+}
+
+func (c *blobCache) put(sha string, result *FileAnalysisResult) error {
+	if sha == "" {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(sha), data, 0o644)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// CommentConfig controls how results are posted on the pull request.
+type CommentConfig struct {
+	// Mode is "summary" (default) for a single results comment, "inline"
+	// for review comments on the offending lines, "inline+summary" for
+	// both, "per-file" for a comment per file, or "none" to post no
+	// comments, e.g. when a check run reports the results. In the inline
+	// modes every issue is rendered once: issues that map to a line of the
+	// diff become review comments and the rest go to the summary.
+	Mode string `json:"mode"`
+	// SortBy orders files in the comment: "filename" (default), "severity"
+	// for the highest severity-weighted issue count first, or "none" to
+	// keep the order GitHub lists the files in.
+	SortBy string `json:"sortBy"`
+	// GroupBy groups the issues in the comment: "file" (default), "severity"
+	// for a "Must fix" group of errors followed by a "Consider" group of
+	// warnings, or "category" for one group per issue category.
+	GroupBy string `json:"groupBy"`
+	// Update decides what a re-run does with the previous summary comment:
+	// "update" (default) edits it in place, "append" posts a new comment
+	// and leaves the old ones, and "recreate" deletes it and posts a new
+	// one at the end of the conversation.
+	Update string `json:"update"`
+	// Stale decides what happens to comments from earlier runs once new
+	// results are posted: "keep" (default), "minimize" to collapse them as
+	// outdated, or "delete".
+	Stale string `json:"stale"`
+	// WhenClean is "comment" (default) to post a short all-clear comment
+	// when no issues are found, or "silent" to post nothing unless an
+	// earlier comment needs updating.
+	WhenClean string `json:"whenClean"`
+	// ResolveFixed resolves the review threads of earlier inline comments
+	// once later commits change the lines they were on.
+	ResolveFixed bool `json:"resolveFixed"`
+	// RequestChanges makes the inline review request changes when any
+	// issue has error severity, instead of only commenting.
+	RequestChanges bool `json:"requestChanges"`
+	// Permalinks links each issue with a line to those lines of the file at
+	// the pull request head.
+	Permalinks bool `json:"permalinks"`
+}
+
+const (
+	commentModeSummary       = "summary"
+	commentModeInline        = "inline"
+	commentModeInlineSummary = "inline+summary"
+	commentModePerFile       = "per-file"
+	commentModeNone          = "none"
+)
+
+const (
+	commentUpdateEdit     = "update"
+	commentUpdateAppend   = "append"
+	commentUpdateRecreate = "recreate"
+)
+
+func (c CommentConfig) update() string {
+	if c.Update == "" {
+		return commentUpdateEdit
+	}
+	return c.Update
+}
+
+const (
+	whenCleanComment = "comment"
+	whenCleanSilent  = "silent"
+)
+
+const (
+	groupBySeverity = "severity"
+	groupByCategory = "category"
+)
+
+func (c CommentConfig) postsInline() bool {
+	return c.Mode == commentModeInline || c.Mode == commentModeInlineSummary
+}
+
+// splitInlineIssues separates issues whose line is part of the file's diff,
+// and can therefore carry a review comment, from those that can't.
+func splitInlineIssues(results []*FileAnalysisResult, patches map[string]string) (inline, rest []*FileAnalysisResult) {
+	rest = make([]*FileAnalysisResult, 0, len(results))
+	for _, result := range results {
+		lines := commentableLines(patches[result.Filename])
+		mapped := &FileAnalysisResult{Filename: result.Filename, SHA: result.SHA}
+		unmapped := &FileAnalysisResult{Filename: result.Filename, SHA: result.SHA}
+		for _, issue := range result.Issues {
+			if issue.Line > 0 && lines[issue.Line] {
+				mapped.Issues = append(mapped.Issues, issue)
+			} else {
+				unmapped.Issues = append(unmapped.Issues, issue)
+			}
+		}
+		if len(mapped.Issues) > 0 {
+			inline = append(inline, mapped)
+		}
+		rest = append(rest, unmapped)
+	}
+	return inline, rest
+}
+
+// inlineMarkerPrefix starts every inline comment, recording the issue type
+// so later runs can find the linter's comments and attribute reactions.
+const inlineMarkerPrefix = "<!-- semantic-lint:inline type="
+
+// inlineMarker returns the marker of an inline comment. The type comes from
+// the model, so it is lowercased and anything but letters, digits, "_" and
+// "-" becomes "-", which can never end the HTML comment.
+func inlineMarker(issueType string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(issueType))
+	return inlineMarkerPrefix + safe + " -->"
+}
+
+// suggestionFits reports whether every line an issue's suggested code
+// replaces is shown in the diff. GitHub only accepts a suggestion on lines
+// of one hunk, and a contiguous run of diff lines is always in one hunk.
+func suggestionFits(issue Issue, lines map[int]bool) bool {
+	if issue.SuggestedCode == "" || issue.Line <= 0 {
+		return false
+	}
+	for line := issue.Line; line <= max(issue.Line, issue.EndLine); line++ {
+		if !lines[line] {
+			return false
+		}
+	}
+	return true
+}
+
+// renderInlineIssue renders an issue's review comment. With suggest set its
+// suggested code becomes a suggestion block the author can apply in one
+// click; otherwise the code is shown as a plain code block.
+func renderInlineIssue(issue Issue, filename string, suggest bool, config *Config) string {
+	severityIcon := "⚠️"
+	if issueSeverity(issue, config) == "error" {
+		severityIcon = "🔴"
+	}
+	body := fmt.Sprintf("%s\n%s **%s**: %s", inlineMarker(issue.Type), severityIcon, issue.Type, issue.Message)
+	if issue.Suggestion != "" {
+		body += fmt.Sprintf("\n\n> Suggestion: %s", issue.Suggestion)
+	}
+	if suggest {
+		body += fmt.Sprintf("\n\n```suggestion\n%s\n```", issue.SuggestedCode)
+	} else if issue.SuggestedCode != "" {
+		body += fmt.Sprintf("\n\n```%s\n%s\n```", detectLanguage(filename), issue.SuggestedCode)
+	}
+	if config.Feedback.Enabled {
+		body += "\n\n" + feedbackPrompt
+	}
+	return body
+}
+
+// reviewMarker starts the text of every review the linter posts, so later
+// runs can find them.
+const reviewMarker = "<!-- semantic-lint:review -->"
+
+const (
+	reviewEventComment        = "COMMENT"
+	reviewEventRequestChanges = "REQUEST_CHANGES"
+)
+
+// reviewEvent returns REQUEST_CHANGES when comment.requestChanges is set and
+// any issue in the results, inline or not, has error severity.
+func reviewEvent(results []*FileAnalysisResult, config *Config) string {
+	if !config.Comment.RequestChanges {
+		return reviewEventComment
+	}
+	for _, result := range results {
+		for _, issue := range result.Issues {
+			if issueSeverity(issue, config) == "error" {
+				return reviewEventRequestChanges
+			}
+		}
+	}
+	return reviewEventComment
+}
+
+// dismissStaleReviews dismisses the linter's earlier reviews that requested
+// changes, so they stop blocking the merge once a newer run has reviewed
+// the pull request. Reviews by anyone else are left alone.
+func dismissStaleReviews(ctx context.Context, client *github.Client, owner, repo string, prNumber int) error {
+	login, err := tokenLogin(ctx, client)
+	if err != nil {
+		return err
+	}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list reviews: %w", err)
+		}
+		for _, review := range reviews {
+			if review.GetState() != "CHANGES_REQUESTED" || !writtenBy(review.GetUser(), login) || !strings.HasPrefix(review.GetBody(), reviewMarker) {
+				continue
+			}
+			dismissal := &github.PullRequestReviewDismissalRequest{Message: github.String("Superseded by a newer semantic linting run.")}
+			if _, _, err := client.PullRequests.DismissReview(ctx, owner, repo, prNumber, review.GetID(), dismissal); err != nil {
+				return fmt.Errorf("failed to dismiss review %d: %w", review.GetID(), err)
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// postInlineComments posts the mapped issues as a single review with one
+// comment per issue. body becomes the review's top-level text and event its
+// state, COMMENT or REQUEST_CHANGES. A comment whose suggested code fits
+// the diff spans the lines it replaces.
+func postInlineComments(ctx context.Context, client *github.Client, owner, repo string, prNumber int, inline []*FileAnalysisResult, patches map[string]string, body, event string, config *Config) error {
+	var comments []*github.DraftReviewComment
+	for _, result := range inline {
+		lines := commentableLines(patches[result.Filename])
+		for _, issue := range result.Issues {
+			suggest := suggestionFits(issue, lines)
+			comment := &github.DraftReviewComment{
+				Path: github.String(result.Filename),
+				Line: github.Int(issue.Line),
+				Side: github.String("RIGHT"),
+				Body: github.String(renderInlineIssue(issue, result.Filename, suggest, config)),
+			}
+			if suggest && issue.EndLine > issue.Line {
+				comment.StartLine = github.Int(issue.Line)
+				comment.StartSide = github.String("RIGHT")
+				comment.Line = github.Int(issue.EndLine)
+			}
+			comments = append(comments, comment)
+		}
+	}
+	if len(comments) == 0 && body == "" && event == reviewEventComment {
+		return nil
+	}
+
+	// A review requesting changes must have text of its own.
+	if body == "" && event == reviewEventRequestChanges {
+		body = "Semantic linting found issues that must be fixed before merging."
+	}
+	review := &github.PullRequestReviewRequest{
+		Event:    github.String(event),
+		Comments: comments,
+	}
+	if body != "" {
+		review.Body = github.String(truncate(reviewMarker+"\n"+body, maxCommentLength))
+	}
+	_, _, err := client.PullRequests.CreateReview(ctx, owner, repo, prNumber, review)
+	return err
+}
+
+func countIssues(results []*FileAnalysisResult) int {
+	count := 0
+	for _, result := range results {
+		count += len(result.Issues)
+	}
+	return count
+}
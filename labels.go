@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// LabelsConfig maps findings to pull request labels. A label is added while
+// any issue matches it and removed once none does, so a clean run removes
+// them all.
+type LabelsConfig struct {
+	// BySeverity maps "error" or "warning" to a label, e.g.
+	// {"error": "needs-semantic-fixes"}.
+	BySeverity map[string]string `json:"bySeverity"`
+	// ByType maps an issue type to a label, e.g.
+	// {"security": "lint:security"}.
+	ByType map[string]string `json:"byType"`
+}
+
+func (c LabelsConfig) enabled() bool {
+	return len(c.BySeverity) > 0 || len(c.ByType) > 0
+}
+
+// matchingLabels returns every configured label, mapped to whether an issue
+// in the results calls for it.
+func matchingLabels(results []*FileAnalysisResult, config *Config) map[string]bool {
+	labels := make(map[string]bool)
+	for _, label := range config.Labels.BySeverity {
+		labels[label] = false
+	}
+	for _, label := range config.Labels.ByType {
+		labels[label] = false
+	}
+	for _, result := range results {
+		for _, issue := range result.Issues {
+			if label, ok := config.Labels.BySeverity[issueSeverity(issue, config)]; ok {
+				labels[label] = true
+			}
+			if label, ok := config.Labels.ByType[issue.Type]; ok {
+				labels[label] = true
+			}
+		}
+	}
+	return labels
+}
+
+// applyLabels adds the labels the findings call for and removes the other
+// configured labels. A run that didn't analyze every file, because it was
+// interrupted, stopped by the budget or the provider failed, only adds
+// labels, since issues in the files it missed are unknown.
+func applyLabels(ctx context.Context, client *github.Client, owner, repo string, prNumber int, report *Report, config *Config) error {
+	current, _, err := client.Issues.ListLabelsByIssue(ctx, owner, repo, prNumber, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return fmt.Errorf("failed to list labels: %w", err)
+	}
+	present := make(map[string]bool, len(current))
+	for _, label := range current {
+		present[label.GetName()] = true
+	}
+
+	var add []string
+	for label, wanted := range matchingLabels(report.Results, config) {
+		switch {
+		case wanted && !present[label]:
+			add = append(add, label)
+		case !wanted && present[label] && report.complete():
+			if _, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, prNumber, label); err != nil {
+				return fmt.Errorf("failed to remove label %q: %w", label, err)
+			}
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	sort.Strings(add)
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, prNumber, add); err != nil {
+		return fmt.Errorf("failed to add labels: %w", err)
+	}
+	return nil
+}
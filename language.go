@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languageByExtension maps file extensions to a language name. Files with
+// an unknown extension have no language.
+var languageByExtension = map[string]string{
+	".go":    "go",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".cs":    "csharp",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".rs":    "rust",
+	".py":    "python",
+	".rb":    "ruby",
+	".sh":    "shell",
+	".php":   "php",
+	".sql":   "sql",
+	".lua":   "lua",
+}
+
+// commentPrefixes lists, per language, the prefixes that start a comment or
+// docstring line.
+var commentPrefixes = map[string][]string{
+	"go":         {"//", "/*", "*"},
+	"javascript": {"//", "/*", "*"},
+	"typescript": {"//", "/*", "*"},
+	"csharp":     {"///", "//", "/*", "*"},
+	"java":       {"//", "/*", "*"},
+	"kotlin":     {"//", "/*", "*"},
+	"swift":      {"///", "//", "/*", "*"},
+	"c":          {"//", "/*", "*"},
+	"cpp":        {"//", "/*", "*"},
+	"rust":       {"///", "//!", "//", "/*", "*"},
+	"python":     {"#", `"""`, "'''"},
+	"ruby":       {"#", "=begin"},
+	"shell":      {"#"},
+	"php":        {"//", "#", "/*", "*"},
+	"sql":        {"--"},
+	"lua":        {"--"},
+}
+
+func detectLanguage(filename string) string {
+	return languageByExtension[strings.ToLower(filepath.Ext(filename))]
+}
+
+// extractDocComments returns the comment lines added by a patch, grouped
+// into blocks separated by "...". It returns "" for files in an unknown
+// language or patches that add no comments.
+//
+// Python docstrings are only recognized by their opening and closing lines;
+// the lines in between are kept because they follow a docstring opener.
+func extractDocComments(filename, patch string) string {
+	prefixes := commentPrefixes[detectLanguage(filename)]
+	if len(prefixes) == 0 {
+		return ""
+	}
+
+	var blocks []string
+	var current []string
+	inDocstring := false
+	flush := func() {
+		if len(current) > 0 {
+			blocks = append(blocks, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(patch, "\n") {
+		if !strings.HasPrefix(line, "+") || strings.HasPrefix(line, "+++") {
+			flush()
+			inDocstring = false
+			continue
+		}
+		text := strings.TrimSpace(line[1:])
+		isComment := inDocstring
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(text, prefix) {
+				isComment = true
+				if (prefix == `"""` || prefix == "'''") && strings.Count(text, prefix) == 1 {
+					inDocstring = !inDocstring
+				}
+				break
+			}
+		}
+		if !isComment {
+			flush()
+			continue
+		}
+		current = append(current, line[1:])
+	}
+	flush()
+
+	return strings.Join(blocks, "\n...\n")
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+// LimitsConfig bounds which files are worth sending to the model.
+type LimitsConfig struct {
+	// MinChangedLines skips files whose patch adds or changes fewer lines,
+	// such as version bumps and typo fixes. Zero analyzes every file.
+	MinChangedLines int `json:"minChangedLines"`
+}
+
+// filterSmallPatches drops files below limits.minChangedLines.
+func filterSmallPatches(files []*ChangedFile, limits LimitsConfig) []*ChangedFile {
+	if limits.MinChangedLines <= 0 {
+		return files
+	}
+	kept := make([]*ChangedFile, 0, len(files))
+	for _, file := range files {
+		if changed := addedLineCount(file.Patch); changed < limits.MinChangedLines {
+			fmt.Fprintf(progress, "::debug::Skipping %s: %d changed line(s), below limits.minChangedLines (%d)\n", file.Filename, changed, limits.MinChangedLines)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runLocal analyzes the changes of the current branch against a base ref in
+// the local repository and prints the issues to the terminal, so they can
+// be fixed before a pull request is opened. It never calls the GitHub API.
+// It returns the process exit code.
+func runLocal(args []string) int {
+	cmd := newSubcommand("local")
+	base := cmd.String("base", "origin/main", "compare HEAD with its merge base with this ref")
+	return cmd.run(args, func(ctx context.Context) int {
+		diff, err := gitOutput(ctx, "diff", "--no-color", "--no-ext-diff", *base+"...HEAD")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error diffing against %s: %v\n", *base, err)
+			return 1
+		}
+		return analyzeLocalDiff(ctx, diff, *cmd.configPath, *cmd.rulesPath, outputText)
+	})
+}
+
+// Output formats of the local and stdin modes.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// runStdin analyzes a unified diff read from standard input, e.g. from
+// "git diff | semantic-linter stdin", for scripts that produce the diff
+// themselves. With -format json the findings are printed as a results
+// artifact instead of text.
+func runStdin(args []string) int {
+	cmd := newSubcommand("stdin")
+	format := cmd.String("format", outputText, "output format: text or json")
+	return cmd.run(args, func(ctx context.Context) int {
+		if *format != outputText && *format != outputJSON {
+			fmt.Fprintf(os.Stderr, "Error in -format: unsupported value %q (want text or json)\n", *format)
+			return 2
+		}
+		diff, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the diff: %v\n", err)
+			return 1
+		}
+		return analyzeLocalDiff(ctx, string(diff), *cmd.configPath, *cmd.rulesPath, *format)
+	})
+}
+
+// analyzeLocalDiff runs the analysis over a diff from git with the config
+// and rules of the working tree, prints the issues in format and returns 1
+// when any has error severity.
+func analyzeLocalDiff(ctx context.Context, diff, configPath, rulesPath, format string) int {
+	// Stdout must hold only the JSON.
+	if format == outputJSON {
+		progress = os.Stderr
+	}
+	analyzer, err := newLocalAnalyzer(configPath, rulesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	config := analyzer.Config
+
+	files, err := filterFiles(parseGitDiff(diff), config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering files: %v\n", err)
+		return 1
+	}
+	files = filterSmallPatches(files, config.Limits)
+	if len(files) == 0 && format == outputText {
+		fmt.Println("No changed files to analyze.")
+		return 0
+	}
+	if config.PackageConfigs {
+		analyzer.Packages, err = discoverPackageConfigs(files, configPath, readLocalFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading package configs: %v\n", err)
+			return 1
+		}
+	}
+
+	report := analyzer.AnalyzeFiles(ctx, files)
+	if format == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(newResultsArtifact(report, config, 0, analyzer.Provider)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+			return 1
+		}
+	} else {
+		printTerminalReport(report, config)
+	}
+	if hasErrors(report.Results, config) || len(report.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// newLocalAnalyzer loads the config and rules from the working tree. The
+// API key is read from the SEMANTIC_LINT_AI_API_KEY environment variable.
+func newLocalAnalyzer(configPath, rulesPath string) (*Analyzer, error) {
+	content, err := readLocalFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	config, err := parseConfig(configPath, []byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	// Issues are printed with their line, so have the model report it.
+	config.numberLines = true
+
+	rules, err := readLocalFile(rulesPath)
+	if err != nil || strings.TrimSpace(rules) == "" {
+		rules = defaultRules
+	}
+	if err := validateRulesScopes(rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+	mappedRules, err := loadMappedRules(config.RulesMap, readLocalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapped rules files: %w", err)
+	}
+
+	provider, err := newProvider(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AI provider: %w", err)
+	}
+	apiKey := os.Getenv("SEMANTIC_LINT_AI_API_KEY")
+	if apiKey == "" && !authenticatesWithoutKey(provider) {
+		return nil, fmt.Errorf("SEMANTIC_LINT_AI_API_KEY is not set")
+	}
+
+	analyzer := &Analyzer{
+		Config:      config,
+		Rules:       rules,
+		MappedRules: mappedRules,
+		APIKey:      apiKey,
+		Provider:    provider,
+	}
+	analyzer.RepoContext, err = loadRepoContext(config.AI, readLocalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository context: %w", err)
+	}
+	return analyzer, nil
+}
+
+func gitOutput(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return string(out), err
+}
+
+// parseGitDiff splits a unified diff into a file per "diff --git" section,
+// or per "--- " and "+++ " header pair for diffs not made by git, with the
+// hunks as its patch in the form the GitHub API returns. Binary files,
+// which have no hunks, are left out.
+func parseGitDiff(diff string) []*ChangedFile {
+	var files []*ChangedFile
+	var current *ChangedFile
+	var patch strings.Builder
+	flush := func() {
+		if current != nil && patch.Len() > 0 {
+			current.Patch = strings.TrimSuffix(patch.String(), "\n")
+			files = append(files, current)
+		}
+		current = nil
+		patch.Reset()
+	}
+	// The lines left in the current hunk, so that a removed line starting
+	// with "-- " is not taken for the header of the next file.
+	oldLines, newLines := 0, 0
+	lines := strings.SplitAfter(diff, "\n")
+	for i, line := range lines {
+		if oldLines > 0 || newLines > 0 {
+			patch.WriteString(line)
+			switch {
+			case strings.HasPrefix(line, "-"):
+				oldLines--
+			case strings.HasPrefix(line, "+"):
+				newLines--
+			case strings.HasPrefix(line, "\\"):
+			default:
+				oldLines--
+				newLines--
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") &&
+			(current == nil || patch.Len() > 0) {
+			// A file without a "diff --git" line.
+			flush()
+			current = &ChangedFile{Status: "modified"}
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			current = &ChangedFile{Status: "modified"}
+		case current == nil:
+		case patch.Len() == 0 && strings.HasPrefix(line, "+++ "):
+			if name := diffHeaderName(line); name == "/dev/null" {
+				current.Status = "removed"
+			} else {
+				current.Filename = strings.TrimPrefix(name, "b/")
+			}
+		case patch.Len() == 0 && strings.HasPrefix(line, "--- "):
+			if name := diffHeaderName(line); name == "/dev/null" {
+				current.Status = "added"
+			} else {
+				current.Filename = strings.TrimPrefix(name, "a/")
+			}
+		case patch.Len() == 0 && strings.HasPrefix(line, "index "):
+			// "index <old>..<new> [mode]"; the new blob identifies the
+			// file version.
+			if _, blobs, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+				blobs, _, _ = strings.Cut(blobs, " ")
+				if _, sha, ok := strings.Cut(blobs, ".."); ok && !isZeroSHA(sha) {
+					current.SHA = sha
+				}
+			}
+		case patch.Len() == 0 && strings.HasPrefix(line, "new file mode"):
+			current.Status = "added"
+		case patch.Len() == 0 && strings.HasPrefix(line, "deleted file mode"):
+			current.Status = "removed"
+		case strings.HasPrefix(line, "@@"):
+			patch.WriteString(line)
+			oldLines, newLines = hunkLengths(line)
+		case patch.Len() > 0 && strings.HasPrefix(line, "\\"):
+			// "\ No newline at end of file" after the last line of a hunk.
+			patch.WriteString(line)
+		}
+	}
+	flush()
+	return files
+}
+
+// diffHeaderName returns the path of a "--- " or "+++ " line, without the
+// timestamp diff -u adds after a tab.
+func diffHeaderName(line string) string {
+	name, _, _ := strings.Cut(line[len("+++ "):], "\t")
+	return strings.TrimSpace(name)
+}
+
+// printTerminalReport prints every issue as "file:line: severity: [type]
+// message", which editors and terminals can link to the file.
+func printTerminalReport(report *Report, config *Config) {
+	for _, result := range report.Results {
+		for _, issue := range result.Issues {
+			location := result.Filename
+			if issue.Line > 0 {
+				location = fmt.Sprintf("%s:%d", location, issue.Line)
+			}
+			fmt.Printf("%s: %s: [%s] %s\n", location, issueSeverity(issue, config), issue.Type, issue.Message)
+			if issue.Suggestion != "" {
+				fmt.Printf("    Suggestion: %s\n", issue.Suggestion)
+			}
+		}
+	}
+	for _, filename := range report.Failed {
+		fmt.Printf("%s: could not be analyzed\n", filename)
+	}
+	errors, warnings := countSeverities(report.Results, config)
+	fmt.Printf("%d error(s), %d warning(s) in %d file(s).\n", errors, warnings, report.TotalFiles)
+}
@@ -4,48 +4,239 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/google/go-github/v57/github"
 	"golang.org/x/oauth2"
 )
 
+// shutdownGracePeriod bounds how long we keep trying to post results after
+// the job has been cancelled.
+const shutdownGracePeriod = 10 * time.Second
+
+// afterCancelGrace returns a context for the work that follows the analysis,
+// such as post-processing and posting results. Unlike ctx it keeps running
+// when the job is cancelled, for up to shutdownGracePeriod.
+func afterCancelGrace(ctx context.Context) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(shutdownGracePeriod, cancel)
+	})
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
 type Config struct {
 	IncludedFiles []string `json:"includedFiles"`
 	ExcludedFiles []string `json:"excludedFiles"`
 	AI            AIConfig `json:"ai"`
 	Severity      Severity `json:"severity"`
+	// ReportBinaryFiles lists changed files without a textual patch in the
+	// comment. They are never sent to the model.
+	ReportBinaryFiles bool          `json:"reportBinaryFiles"`
+	Budget            BudgetConfig  `json:"budget"`
+	Docs              DocsConfig    `json:"docs"`
+	Comment           CommentConfig `json:"comment"`
+	Check             CheckConfig   `json:"check"`
+	Status            StatusConfig  `json:"status"`
+	Labels            LabelsConfig  `json:"labels"`
+	// PostProcessCommand is an executable that may filter, reclassify or
+	// enrich the results before they are posted. See runPostProcess.
+	PostProcessCommand string              `json:"postProcessCommand"`
+	TrackingIssue      TrackingIssueConfig `json:"trackingIssue"`
+	// RulesMap maps path globs to rules files, so files in different parts
+	// of the repository are checked against different rules.
+	RulesMap map[string]string `json:"rulesMap"`
+	Scoring  ScoringConfig     `json:"scoring"`
+	// RequireRules makes a missing or empty rules file an error. When set
+	// to false the built-in defaultRules are used instead. Defaults to true.
+	RequireRules *bool          `json:"requireRules"`
+	Feedback     FeedbackConfig `json:"feedback"`
+	// AuthorChangesOnly diffs the pull request head against its merge base
+	// so code merged in from the base branch is not analyzed.
+	AuthorChangesOnly bool `json:"authorChangesOnly"`
+	// PackageConfigs looks for a config file at the config path inside each
+	// directory of a changed file's path, so packages of a monorepo can
+	// bring their own rules and instructions. See PackageConfig.
+	PackageConfigs bool `json:"packageConfigs"`
+	// ValidateSuggestions drops suggested code for Go files that would not
+	// parse once applied. It fetches the changed files' content.
+	ValidateSuggestions bool `json:"validateSuggestions"`
+	// UseHeadConfig reads the config and rules from the pull request head
+	// instead of its base. Only the base branch's value counts, so a pull
+	// request can't switch it on for itself.
+	UseHeadConfig bool `json:"useHeadConfig"`
+	// ExclusionWarningPercent is the share of changed source files that
+	// the include/exclude patterns may filter out before a warning about
+	// the patterns is logged. Defaults to 80; 100 turns the warning off.
+	ExclusionWarningPercent int          `json:"exclusionWarningPercent"`
+	Limits                  LimitsConfig `json:"limits"`
+	// OwnedBy limits analysis to the files CODEOWNERS assigns to this user
+	// or team, e.g. "@org/payments". Empty analyzes every file.
+	OwnedBy string `json:"ownedBy"`
+	// TriggerActions lists the pull request event actions the linter runs
+	// for. Defaults to opened, synchronize and reopened.
+	TriggerActions []string         `json:"triggerActions"`
+	Heuristics     HeuristicsConfig `json:"heuristics"`
+	FullScan       FullScanConfig   `json:"fullScan"`
+	// Drafts is "analyze" (default), "skip" or "quiet" for draft pull
+	// requests.
+	Drafts string `json:"drafts"`
+
+	// numberLines numbers the patch lines and asks for each issue's line
+	// even when no output places issues on lines, e.g. for the terminal
+	// output of local runs.
+	numberLines bool
+}
+
+func (c *Config) requiresRules() bool {
+	return c.RequireRules == nil || *c.RequireRules
+}
+
+// DocsConfig enables a second pass that reviews only the doc comments added
+// in each file against a dedicated documentation rules file.
+type DocsConfig struct {
+	Enabled   bool   `json:"enabled"`
+	RulesFile string `json:"rulesFile"`
+	// Category tags the issues found by this pass. Defaults to "docs".
+	Category string `json:"category"`
 }
 
 type AIConfig struct {
-	Provider       string            `json:"provider"`
-	PromptTemplate string            `json:"promptTemplate"`
-	Gemini         GeminiConfig      `json:"gemini"`
-	OpenAI         OpenAIConfig      `json:"openai"`
-	Anthropic      AnthropicConfig   `json:"anthropic"`
+	Provider       string `json:"provider"`
+	PromptTemplate string `json:"promptTemplate"`
+	// TemplateVars are available to the prompt template as {{.Vars.name}}.
+	TemplateVars map[string]string `json:"templateVars"`
+	// MaxOutputTokens caps the length of the model's response. Zero keeps
+	// the provider's default.
+	MaxOutputTokens int `json:"maxOutputTokens"`
+	// RepoContext is background about the project, such as its error
+	// handling or logging conventions, added to every prompt.
+	// RepoContextFile names a file to read it from instead.
+	RepoContext     string `json:"repoContext"`
+	RepoContextFile string `json:"repoContextFile"`
+	// Headers are added to every provider request, e.g. tenant or routing
+	// keys required by an LLM gateway. They never replace auth headers.
+	Headers map[string]string `json:"headers"`
+	// StrictJSON logs a warning for every response that wasn't pure JSON
+	// and reports how many there were, to measure how well the prompt
+	// keeps the model to the format. Results are extracted either way.
+	StrictJSON      bool                  `json:"strictJSON"`
+	ContextRequests ContextRequestsConfig `json:"contextRequests"`
+	EmptyRetry      EmptyRetryConfig      `json:"emptyRetry"`
+	Deadline        DeadlineConfig        `json:"deadline"`
+	// OnProviderError decides what happens to a file the provider fails
+	// on: "note" (default) lists it in the comment, "skip" only logs it,
+	// and "fail" lists it and makes the run fail.
+	OnProviderError string `json:"onProviderError"`
+	// Fallback lists providers to try, in order, when ai.provider fails
+	// on a file.
+	Fallback  []FallbackProviderConfig `json:"fallback"`
+	Consensus ConsensusConfig          `json:"consensus"`
+	// ModelByPath and ModelByCategory override the provider's model for
+	// some files. Paths are globs; categories are languages as detected
+	// from the file extension (e.g. "go", "typescript") or the docs pass
+	// category.
+	ModelByPath     map[string]string `json:"modelByPath"`
+	ModelByCategory map[string]string `json:"modelByCategory"`
+	// ModelRoutes pick a model by patch size, language and path. The first
+	// matching route wins.
+	ModelRoutes      []ModelRoute           `json:"modelRoutes"`
+	Gemini           GeminiConfig           `json:"gemini"`
+	OpenAI           OpenAIConfig           `json:"openai"`
+	Anthropic        AnthropicConfig        `json:"anthropic"`
+	AzureOpenAI      AzureOpenAIConfig      `json:"azureOpenAI"`
+	Ollama           OllamaConfig           `json:"ollama"`
+	OpenAICompatible OpenAICompatibleConfig `json:"openaiCompatible"`
+	Cohere           CohereConfig           `json:"cohere"`
+	Exec             ExecProviderConfig     `json:"exec"`
+	// Mistral, Groq and Grok serve the OpenAI request format and are
+	// configured like ai.openai, with their own defaults.
+	Mistral OpenAIConfig `json:"mistral"`
+	Groq    OpenAIConfig `json:"groq"`
+	Grok    OpenAIConfig `json:"grok"`
+}
+
+const (
+	providerErrorNote = "note"
+	providerErrorSkip = "skip"
+	providerErrorFail = "fail"
+)
+
+func (c AIConfig) onProviderError() string {
+	if c.OnProviderError == "" {
+		return providerErrorNote
+	}
+	return c.OnProviderError
 }
 
 type GeminiConfig struct {
-	APIEndpoint string            `json:"apiEndpoint"`
-	Headers     map[string]string `json:"headers"`
+	APIEndpoint string `json:"apiEndpoint"`
+	// Model replaces the model named in the endpoint URL, if set.
+	Model   string            `json:"model"`
+	Headers map[string]string `json:"headers"`
+	// SafetySettings are passed through to the API, e.g. to relax blocking
+	// that trips on security-related code.
+	SafetySettings []GeminiSafetySetting `json:"safetySettings"`
+	// Vertex, if set, sends requests through Vertex AI. APIEndpoint is
+	// then ignored.
+	Vertex     *VertexConfig    `json:"vertex"`
+	Generation GenerationParams `json:"generation"`
+	// StructuredOutput asks for JSON matching geminiResponseSchema.
+	// Defaults to true; turn it off for models without JSON mode.
+	StructuredOutput *bool `json:"structuredOutput"`
+	// ToolCalling has the model return its result as the arguments of a
+	// report_issues tool call. It takes precedence over StructuredOutput.
+	ToolCalling bool `json:"toolCalling"`
+	// CacheRules uploads each rules document once per run as cached
+	// content and refers to it instead of resending it with every file.
+	CacheRules bool `json:"cacheRules"`
+}
+
+type GeminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
 }
 
+// OpenAIConfig configures the chat completions API. Every field is
+// optional: the endpoint defaults to api.openai.com, the model to
+// defaultOpenAIModel, and the key is sent as a bearer token.
 type OpenAIConfig struct {
 	APIEndpoint string            `json:"apiEndpoint"`
 	Model       string            `json:"model"`
 	Headers     map[string]string `json:"headers"`
+	Generation  GenerationParams  `json:"generation"`
+	// ToolCalling has the model return its result as the arguments of a
+	// report_issues tool call.
+	ToolCalling bool `json:"toolCalling"`
 }
 
+// AnthropicConfig configures the Messages API. As with OpenAIConfig every
+// field is optional.
 type AnthropicConfig struct {
 	APIEndpoint string            `json:"apiEndpoint"`
 	Model       string            `json:"model"`
 	Headers     map[string]string `json:"headers"`
+	// MaxTokens is sent as max_tokens, overriding ai.maxOutputTokens and
+	// generation.maxOutputTokens.
+	MaxTokens  int              `json:"maxTokens"`
+	Generation GenerationParams `json:"generation"`
+	// ToolCalling has the model return its result as the input of a
+	// report_issues tool call.
+	ToolCalling bool `json:"toolCalling"`
 }
 
 type Severity struct {
@@ -56,28 +247,87 @@ type Severity struct {
 type ChangedFile struct {
 	Filename string
 	Patch    string
+	Status   string
+	SHA      string
 }
 
 type AnalysisResult struct {
 	Issues []Issue `json:"issues"`
+	// NeedContext lists files the model asked to see before answering. It
+	// is only honoured when ai.contextRequests is enabled.
+	NeedContext []ContextRequest `json:"needContext,omitempty"`
+	// FormatViolation is set when the response wasn't pure JSON and the
+	// result had to be extracted from around it.
+	FormatViolation bool `json:"-"`
+	// Usage is the token usage the provider reported, if any.
+	Usage TokenUsage `json:"-"`
+}
+
+// TokenUsage counts the tokens of one or more provider requests, as the
+// providers report them.
+type TokenUsage struct {
+	PromptTokens int `json:"promptTokens"`
+	OutputTokens int `json:"outputTokens"`
+	// reported is set when a provider reported the counts. Cohere, Ollama
+	// and exec report none, and their zero counts mean unknown.
+	reported bool
+}
+
+func (u *TokenUsage) add(other TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.OutputTokens += other.OutputTokens
+	u.reported = u.reported || other.reported
 }
 
 type Issue struct {
 	Type       string `json:"type"`
 	Message    string `json:"message"`
 	Suggestion string `json:"suggestion"`
+	Line       int    `json:"line,omitempty"`
+	// EndLine closes the range of lines, starting at Line, that
+	// SuggestedCode replaces.
+	EndLine       int    `json:"endLine,omitempty"`
+	SuggestedCode string `json:"suggestedCode,omitempty"`
+	// Severity is filled in by the Aggregator from the config. A severity
+	// the model returns is dropped, so it can't downgrade an error; a
+	// post-process command or heuristic may set it to reclassify an issue.
+	Severity string `json:"severity,omitempty"`
+	// Category is set by the tool, not the model, to tell apart issues from
+	// separate analysis passes such as the docs pass.
+	Category string `json:"category,omitempty"`
 }
 
 type FileAnalysisResult struct {
-	Filename string
-	Issues   []Issue
+	Filename string `json:"filename"`
+	// SHA is the blob SHA of the analyzed file version, used to skip files
+	// that are unchanged since the previous run.
+	SHA    string  `json:"sha,omitempty"`
+	Issues []Issue `json:"issues"`
 }
 
 type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	Contents         []GeminiContent         `json:"contents"`
+	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	SafetySettings   []GeminiSafetySetting   `json:"safetySettings,omitempty"`
+	Tools            []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig       *GeminiToolConfig       `json:"toolConfig,omitempty"`
+	CachedContent    string                  `json:"cachedContent,omitempty"`
+}
+
+type GeminiGenerationConfig struct {
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	TopK            *int     `json:"topK,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	// ResponseMimeType "application/json" with ResponseSchema makes the
+	// model answer with JSON of that shape.
+	ResponseMimeType string         `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
 }
 
 type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
 	Parts []GeminiPart `json:"parts"`
 }
 
@@ -89,29 +339,118 @@ type GeminiResponse struct {
 	Candidates []struct {
 		Content struct {
 			Parts []struct {
-				Text string `json:"text"`
+				Text         string `json:"text"`
+				FunctionCall *struct {
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall"`
 			} `json:"parts"`
 		} `json:"content"`
+		FinishReason string `json:"finishReason"`
 	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
 }
 
+const (
+	defaultOpenAIEndpoint = "https://api.openai.com/v1/chat/completions"
+	defaultOpenAIModel    = "gpt-4o"
+)
+
+// Defaults for vendors serving the OpenAI chat completions API.
+const (
+	defaultMistralEndpoint = "https://api.mistral.ai/v1/chat/completions"
+	defaultMistralModel    = "mistral-large-latest"
+	defaultGroqEndpoint    = "https://api.groq.com/openai/v1/chat/completions"
+	defaultGroqModel       = "llama-3.3-70b-versatile"
+	defaultGrokEndpoint    = "https://api.x.ai/v1/chat/completions"
+	defaultGrokModel       = "grok-2-latest"
+)
+
+// withDefaults fills in the endpoint and model of an OpenAI-compatible
+// vendor where the config leaves them empty.
+func (c OpenAIConfig) withDefaults(endpoint, model string) OpenAIConfig {
+	if c.APIEndpoint == "" {
+		c.APIEndpoint = endpoint
+	}
+	if c.Model == "" {
+		c.Model = model
+	}
+	return c
+}
+
+// setProviderHeaders sets a provider's default headers, then the configured
+// ones, which take precedence. "{{AI_API_KEY}}" in either is replaced with
+// the API key. A configured empty value removes a default header.
+func setProviderHeaders(req *http.Request, defaults, configured map[string]string, apiKey string) {
+	for key, value := range defaults {
+		req.Header.Set(key, strings.ReplaceAll(value, "{{AI_API_KEY}}", apiKey))
+	}
+	for key, value := range configured {
+		if value == "" {
+			req.Header.Del(key)
+			continue
+		}
+		req.Header.Set(key, strings.ReplaceAll(value, "{{AI_API_KEY}}", apiKey))
+	}
+}
+
+// errOutputTruncated is returned when the model stopped because it hit its
+// output token limit, which leaves the JSON result incomplete.
+var errOutputTruncated = errors.New("model output was truncated at the max output token limit; raise ai.maxOutputTokens or split the change")
+
 type LLMProvider interface {
-	Analyze(patch, prompt, apiKey string) (*AnalysisResult, error)
+	Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error)
+}
+
+// ModelSelectable is implemented by providers whose model can be switched
+// per file.
+type ModelSelectable interface {
+	WithModel(model string) LLMProvider
 }
 
 type GeminiProvider struct {
-	Config GeminiConfig
+	Config          GeminiConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+	// TokenSource authenticates Vertex AI requests with a service account.
+	// When nil in Vertex mode, the API key is sent as the access token.
+	TokenSource oauth2.TokenSource
+
+	// rulesCache is shared by the copies made for other models and is nil
+	// unless cacheRules is set. cachedContent names the cache a copy's
+	// requests refer to, and cachedRules is the rules it holds, which are
+	// left out of the prompt.
+	rulesCache    *geminiRulesCache
+	cachedContent string
+	cachedRules   string
+	// Stream requests the response as server-sent events.
+	Stream bool
 }
 
 type OpenAIProvider struct {
-	Config OpenAIConfig
+	Config          OpenAIConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+	Stream          bool
 }
 
 type AnthropicProvider struct {
-	Config AnthropicConfig
+	Config          AnthropicConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+	Stream          bool
 }
 
-func (p *GeminiProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult, error) {
+func (p *GeminiProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	if p.cachedContent != "" {
+		prompt = strings.Replace(prompt, p.cachedRules, cachedRulesNote, 1)
+	}
 	geminiReq := GeminiRequest{
 		Contents: []GeminiContent{
 			{
@@ -123,6 +462,25 @@ func (p *GeminiProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult,
 			},
 		},
 	}
+	generation := p.Config.Generation
+	geminiReq.GenerationConfig = &GeminiGenerationConfig{
+		MaxOutputTokens: generation.maxOutputTokens(p.MaxOutputTokens),
+		Temperature:     generation.Temperature,
+		TopP:            generation.TopP,
+		TopK:            generation.TopK,
+		StopSequences:   generation.StopSequences,
+	}
+	if p.Config.ToolCalling {
+		// With cached rules, the tool is part of the cache.
+		if p.cachedContent == "" {
+			geminiReq.Tools, geminiReq.ToolConfig = geminiReportIssuesTool()
+		}
+	} else if p.Config.structuredOutput() {
+		geminiReq.GenerationConfig.ResponseMimeType = "application/json"
+		geminiReq.GenerationConfig.ResponseSchema = geminiResponseSchema
+	}
+	geminiReq.SafetySettings = p.Config.SafetySettings
+	geminiReq.CachedContent = p.cachedContent
 
 	bodyBytes, err := json.Marshal(geminiReq)
 	if err != nil {
@@ -130,8 +488,18 @@ func (p *GeminiProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult,
 	}
 
 	endpoint := strings.Replace(p.Config.APIEndpoint, "{{AI_API_KEY}}", apiKey, -1)
+	if p.Config.Vertex != nil {
+		endpoint = p.Config.Vertex.endpoint(p.Config.Model)
+	} else if p.Config.Model != "" {
+		endpoint = geminiModelPattern.ReplaceAllString(endpoint, "/models/"+p.Config.Model+":")
+	}
+	if p.Stream {
+		if endpoint, err = geminiStreamEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+	}
 
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -139,9 +507,20 @@ func (p *GeminiProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult,
 	for key, value := range p.Config.Headers {
 		req.Header.Set(key, value)
 	}
+	if p.Config.Vertex != nil {
+		token := apiKey
+		if p.TokenSource != nil {
+			t, err := p.TokenSource.Token()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get GCP access token: %w", err)
+			}
+			token = t.AccessToken
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -153,30 +532,107 @@ func (p *GeminiProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult,
 	}
 
 	var geminiResp GeminiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+	if p.Stream {
+		streamed, err := decodeGeminiStream(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gemini response stream: %w", err)
+		}
+		geminiResp = *streamed
+	} else if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
 		return nil, fmt.Errorf("failed to decode gemini response: %w", err)
 	}
 
+	if len(geminiResp.Candidates) > 0 && geminiResp.Candidates[0].FinishReason == "MAX_TOKENS" {
+		return nil, errOutputTruncated
+	}
 	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no content found in gemini response")
+		return nil, explainEmptyGeminiResponse(&geminiResp)
+	}
+
+	var result *AnalysisResult
+	part := geminiResp.Candidates[0].Content.Parts[0]
+	if part.FunctionCall != nil {
+		result, err = parseToolArguments(part.FunctionCall.Name, part.FunctionCall.Args, "gemini")
+	} else {
+		result, err = parseAnalysisResult(part.Text, "gemini")
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Usage = TokenUsage{
+		PromptTokens: geminiResp.UsageMetadata.PromptTokenCount,
+		OutputTokens: geminiResp.UsageMetadata.CandidatesTokenCount,
+		reported:     true,
 	}
+	return result, nil
+}
+
+// geminiModelPattern matches the model segment of a Gemini endpoint URL.
+var geminiModelPattern = regexp.MustCompile(`/models/[^/:]+:`)
+
+func (p *GeminiProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
+
+func (p *OpenAIProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
+
+func (p *AnthropicProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
 
-	jsonString := geminiResp.Candidates[0].Content.Parts[0].Text
-	jsonString = strings.TrimPrefix(jsonString, "```json")
-	jsonString = strings.TrimSuffix(jsonString, "```")
-	jsonString = strings.TrimSpace(jsonString)
+// explainEmptyGeminiResponse turns a response without content into an error
+// that says why, based on the prompt block reason or the finish reason.
+func explainEmptyGeminiResponse(resp *GeminiResponse) error {
+	const safetyHint = "; if the code is being misclassified, relax ai.gemini.safetySettings"
 
-	var result AnalysisResult
-	if err := json.Unmarshal([]byte(jsonString), &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal analysis result from gemini response: %w", err)
+	if reason := resp.PromptFeedback.BlockReason; reason != "" {
+		hint := ""
+		if reason == "SAFETY" {
+			hint = safetyHint
+		}
+		return fmt.Errorf("gemini blocked the prompt: %s%s", reason, hint)
+	}
+	if len(resp.Candidates) == 0 {
+		return fmt.Errorf("no candidates in gemini response; the prompt may be too long or malformed")
 	}
 
-	return &result, nil
+	switch reason := resp.Candidates[0].FinishReason; reason {
+	case "SAFETY", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return fmt.Errorf("gemini blocked the response: %s%s", reason, safetyHint)
+	case "RECITATION":
+		return fmt.Errorf("gemini blocked the response: RECITATION (output resembled existing material)")
+	case "", "STOP":
+		return fmt.Errorf("no content found in gemini response")
+	default:
+		return fmt.Errorf("no content found in gemini response (finish reason %s)", reason)
+	}
 }
 
 type OpenAIRequest struct {
-	Model    string           `json:"model"`
-	Messages []OpenAIMessage `json:"messages"`
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
+	Stop        []string        `json:"stop,omitempty"`
+	Tools       []OpenAITool    `json:"tools,omitempty"`
+	ToolChoice  *OpenAITool     `json:"tool_choice,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	// StreamOptions asks for the usage in a final chunk of a streamed
+	// response, which otherwise has none.
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type OpenAIMessage struct {
@@ -186,21 +642,55 @@ type OpenAIMessage struct {
 
 type OpenAIResponse struct {
 	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
+		Message OpenAIResponseMessage `json:"message"`
+		// Delta is the part of the message sent in one streamed chunk.
+		Delta        OpenAIResponseMessage `json:"delta"`
+		FinishReason string                `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 }
 
-func (p *OpenAIProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult, error) {
+type OpenAIResponseMessage struct {
+	Content   string           `json:"content"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls"`
+}
+
+type OpenAIToolCall struct {
+	Index    int `json:"index"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func (p *OpenAIProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	model := p.Config.Model
+	if model == "" {
+		model = defaultOpenAIModel
+	}
 	openAIReq := OpenAIRequest{
-		Model: p.Config.Model,
+		Model: model,
 		Messages: []OpenAIMessage{
 			{
 				Role:    "user",
 				Content: prompt,
 			},
 		},
+		MaxTokens:   p.Config.Generation.maxOutputTokens(p.MaxOutputTokens),
+		Temperature: p.Config.Generation.Temperature,
+		TopP:        p.Config.Generation.TopP,
+		Stop:        p.Config.Generation.StopSequences,
+		Stream:      p.Stream,
+	}
+	if p.Stream {
+		openAIReq.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+	}
+	if p.Config.ToolCalling {
+		openAIReq.Tools = openAIReportIssuesTool()
+		openAIReq.ToolChoice = &OpenAITool{Type: "function", Function: OpenAIToolFunction{Name: reportIssuesTool}}
 	}
 
 	bodyBytes, err := json.Marshal(openAIReq)
@@ -208,18 +698,21 @@ func (p *OpenAIProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult,
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", p.Config.APIEndpoint, bytes.NewBuffer(bodyBytes))
+	endpoint := p.Config.APIEndpoint
+	if endpoint == "" {
+		endpoint = defaultOpenAIEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	for key, value := range p.Config.Headers {
-		value = strings.Replace(value, "{{AI_API_KEY}}", apiKey, -1)
-		req.Header.Set(key, value)
-	}
+	setProviderHeaders(req, map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer {{AI_API_KEY}}",
+	}, p.Config.Headers, apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -231,31 +724,51 @@ func (p *OpenAIProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult,
 	}
 
 	var openAIResp OpenAIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
+	if p.Stream {
+		streamed, err := decodeOpenAIStream(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read openai response stream: %w", err)
+		}
+		openAIResp = *streamed
+	} else if err := json.NewDecoder(resp.Body).Decode(&openAIResp); err != nil {
 		return nil, fmt.Errorf("failed to decode openai response: %w", err)
 	}
 
 	if len(openAIResp.Choices) == 0 {
 		return nil, fmt.Errorf("no choices found in openai response")
 	}
-
-	jsonString := openAIResp.Choices[0].Message.Content
-	jsonString = strings.TrimPrefix(jsonString, "```json")
-	jsonString = strings.TrimSuffix(jsonString, "```")
-	jsonString = strings.TrimSpace(jsonString)
-
-	var result AnalysisResult
-	if err := json.Unmarshal([]byte(jsonString), &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal analysis result from openai response: %w", err)
+	if openAIResp.Choices[0].FinishReason == "length" {
+		return nil, errOutputTruncated
 	}
 
-	return &result, nil
+	var result *AnalysisResult
+	message := openAIResp.Choices[0].Message
+	if len(message.ToolCalls) > 0 {
+		call := message.ToolCalls[0].Function
+		result, err = parseToolArguments(call.Name, []byte(call.Arguments), "openai")
+	} else {
+		result, err = parseAnalysisResult(message.Content, "openai")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usage := openAIResp.Usage; usage != nil {
+		result.Usage = TokenUsage{PromptTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens, reported: true}
+	}
+	return result, nil
 }
 
 type AnthropicRequest struct {
-	Model    string             `json:"model"`
-	Messages []AnthropicMessage `json:"messages"`
-	MaxTokens int                `json:"max_tokens"`
+	Model         string             `json:"model"`
+	Messages      []AnthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          *int               `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]string  `json:"tool_choice,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
 }
 
 type AnthropicMessage struct {
@@ -264,21 +777,64 @@ type AnthropicMessage struct {
 }
 
 type AnthropicResponse struct {
-	Content []struct {
-		Text string `json:"text"`
-	} `json:"content"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
 }
 
-func (p *AnthropicProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResult, error) {
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type AnthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// defaultAnthropicMaxTokens is used when no limit is configured, since the
+// Messages API requires max_tokens on every request.
+const defaultAnthropicMaxTokens = 4096
+
+const (
+	defaultAnthropicEndpoint = "https://api.anthropic.com/v1/messages"
+	defaultAnthropicModel    = "claude-3-5-sonnet-latest"
+	anthropicAPIVersion      = "2023-06-01"
+)
+
+func (p *AnthropicProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	maxTokens := p.Config.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = p.Config.Generation.maxOutputTokens(p.MaxOutputTokens)
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	model := p.Config.Model
+	if model == "" {
+		model = defaultAnthropicModel
+	}
+
 	anthropicReq := AnthropicRequest{
-		Model: p.Config.Model,
+		Model: model,
 		Messages: []AnthropicMessage{
 			{
 				Role:    "user",
 				Content: prompt,
 			},
 		},
-		MaxTokens: 4096,
+		MaxTokens:     maxTokens,
+		Temperature:   p.Config.Generation.Temperature,
+		TopP:          p.Config.Generation.TopP,
+		TopK:          p.Config.Generation.TopK,
+		StopSequences: p.Config.Generation.StopSequences,
+		Stream:        p.Stream,
+	}
+	if p.Config.ToolCalling {
+		anthropicReq.Tools = anthropicReportIssuesTool()
+		anthropicReq.ToolChoice = map[string]string{"type": "tool", "name": reportIssuesTool}
 	}
 
 	bodyBytes, err := json.Marshal(anthropicReq)
@@ -286,18 +842,22 @@ func (p *AnthropicProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResu
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", p.Config.APIEndpoint, bytes.NewBuffer(bodyBytes))
+	endpoint := p.Config.APIEndpoint
+	if endpoint == "" {
+		endpoint = defaultAnthropicEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	for key, value := range p.Config.Headers {
-		value = strings.Replace(value, "{{AI_API_KEY}}", apiKey, -1)
-		req.Header.Set(key, value)
-	}
+	setProviderHeaders(req, map[string]string{
+		"Content-Type":      "application/json",
+		"x-api-key":         "{{AI_API_KEY}}",
+		"anthropic-version": anthropicAPIVersion,
+	}, p.Config.Headers, apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -309,97 +869,407 @@ func (p *AnthropicProvider) Analyze(patch, prompt, apiKey string) (*AnalysisResu
 	}
 
 	var anthropicResp AnthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+	if p.Stream {
+		streamed, err := decodeAnthropicStream(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read anthropic response stream: %w", err)
+		}
+		anthropicResp = *streamed
+	} else if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
 		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
 	}
 
 	if len(anthropicResp.Content) == 0 {
 		return nil, fmt.Errorf("no content found in anthropic response")
 	}
-
-	jsonString := anthropicResp.Content[0].Text
-	jsonString = strings.TrimPrefix(jsonString, "```json")
-	jsonString = strings.TrimSuffix(jsonString, "```")
-	jsonString = strings.TrimSpace(jsonString)
-
-	var result AnalysisResult
-	if err := json.Unmarshal([]byte(jsonString), &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal analysis result from anthropic response: %w", err)
+	if anthropicResp.StopReason == "max_tokens" {
+		return nil, errOutputTruncated
 	}
 
-	return &result, nil
+	var result *AnalysisResult
+	for _, block := range anthropicResp.Content {
+		if block.Type == "tool_use" {
+			result, err = parseToolArguments(block.Name, block.Input, "anthropic")
+			break
+		}
+	}
+	if result == nil && err == nil {
+		result, err = parseAnalysisResult(anthropicResp.Content[0].Text, "anthropic")
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Usage = TokenUsage{PromptTokens: anthropicResp.Usage.InputTokens, OutputTokens: anthropicResp.Usage.OutputTokens, reported: true}
+	return result, nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "local":
+			os.Exit(runLocal(os.Args[2:]))
+		case "stdin", "--stdin":
+			os.Exit(runStdin(os.Args[2:]))
+		case "hook":
+			os.Exit(runHook(os.Args[2:]))
+		case "github":
+			os.Exit(runGitHub(os.Args[2:]))
+		case "gitlab":
+			os.Exit(runGitLab(os.Args[2:]))
+		case "bitbucket":
+			os.Exit(runBitbucket(os.Args[2:]))
+		case "azure-devops":
+			os.Exit(runAzureDevOps(os.Args[2:]))
+		case "gerrit":
+			os.Exit(runGerrit(os.Args[2:]))
+		}
+	}
+
 	fmt.Println("Starting semantic linter...")
 
 	githubToken := os.Getenv("INPUT_GITHUB-TOKEN")
-	if githubToken == "" {
+	appID := os.Getenv("INPUT_APP-ID")
+	if githubToken == "" && appID == "" {
 		fmt.Println("GitHub token is not set.")
 		os.Exit(1)
 	}
 
-	aiAPIKey := os.Getenv("INPUT_AI-API-KEY")
-	if aiAPIKey == "" {
-		fmt.Println("AI API key is not set.")
+	// A combine run only merges results posted by earlier jobs, so it never
+	// talks to the AI provider.
+	combine := getBoolInput("COMBINE")
+	jobID := os.Getenv("INPUT_JOB-ID")
+	shardIndex, shardTotal, err := shardInputs()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+	// Each shard stores its results for the combine step, like a matrix
+	// job.
+	if shardTotal > 1 && jobID == "" {
+		jobID = fmt.Sprintf("shard-%d", shardIndex)
+	}
+
+	aiAPIKey := os.Getenv("INPUT_AI-API-KEY")
 
 	configPath := os.Getenv("INPUT_CONFIG-PATH")
 	if configPath == "" {
-		configPath = ".github/semantic-lint.config.json"
+		configPath = defaultConfigPath
 	}
 
 	rulesPath := os.Getenv("INPUT_RULES-PATH")
 	if rulesPath == "" {
-		rulesPath = ".github/SemanticLintingRules.md"
+		rulesPath = defaultRulesPath
+	}
+
+	// Cancel the root context when the runner cancels the job so in-flight
+	// provider calls abort and a partial comment can still be posted.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	owner, repo := getRepoInfo()
+
+	// An app's installation token takes the place of github-token, so
+	// comments come from the app's bot.
+	if appID != "" {
+		token, err := appInstallationToken(ctx, appID, os.Getenv("INPUT_APP-PRIVATE-KEY"), os.Getenv("INPUT_APP-INSTALLATION-ID"), owner, repo)
+		if err != nil {
+			fmt.Printf("Error authenticating as GitHub App %s: %v\n", appID, err)
+			os.Exit(1)
+		}
+		fmt.Printf("::add-mask::%s\n", token)
+		githubToken = token
 	}
 
-	config, err := loadConfig(configPath)
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: githubToken},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+	client, err := withAPIURLs(github.NewClient(tc))
+	if err != nil {
+		fmt.Printf("Error in api-url: %v\n", err)
+		os.Exit(1)
+	}
+
+	mode := os.Getenv("INPUT_MODE")
+	var commits *CommitRange
+	switch mode {
+	case "", modePullRequest:
+		commits, err = commitRangeFromEvent()
+		if err == nil && commits == nil {
+			commits, err = commitRangeFromInputs(ctx, client, owner, repo)
+		}
+	case modeFullScan:
+		// The scan is of the checked-out commit.
+		commits = &CommitRange{Ref: os.Getenv("GITHUB_REF"), Head: os.Getenv("GITHUB_SHA")}
+	case modePost:
+		os.Exit(runPost(ctx, client, owner, repo, configPath))
+	default:
+		fmt.Printf("Error in mode: unsupported value %q (want pull-request, full-scan or post)\n", mode)
+		os.Exit(1)
+	}
+	if errors.Is(err, errBranchDeleted) {
+		fmt.Println("Skipping: the push deleted the branch.")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error getting the commits to analyze: %v\n", err)
+		os.Exit(1)
+	}
+	var prNumber int
+	if commits == nil {
+		prNumber, err = getPullRequestNumber()
+		if err != nil {
+			fmt.Printf("Error getting pull request number: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Pushes and manual runs are started by someone with write access, so
+	// the checkout is trusted for the config.
+	readFile := readLocalFile
+	if commits == nil {
+		readFile, configPath, err = configReader(ctx, client, owner, repo, prNumber, configPath)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		configPath = resolveConfigPath(configPath, readLocalFile)
+	}
+
+	configContent, err := readFile(configPath)
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	config, err := parseConfig(configPath, []byte(configContent))
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	var command *SlashCommand
+	if isCommentEvent() {
+		command, err = slashCommandFromEvent()
+		if err != nil {
+			fmt.Printf("Error reading %s command: %v\n", slashCommandName, err)
+			os.Exit(1)
+		}
+		if command == nil {
+			fmt.Printf("Skipping: the comment is not a %s command.\n", slashCommandName)
+			return
+		}
+		if err := command.acknowledge(ctx, client, owner, repo); err != nil {
+			fmt.Printf("Error reacting to the command: %v\n", err)
+		}
+	} else if action := eventAction(); !triggeredBy(action, config) {
+		fmt.Printf("Skipping: event action %q is not in triggerActions.\n", action)
+		return
+	}
+	switch config.drafts() {
+	case draftsAnalyze, draftsSkip, draftsQuiet:
+	default:
+		fmt.Printf("Error in drafts: unsupported value %q (want analyze, skip or quiet)\n", config.Drafts)
+		os.Exit(1)
+	}
+	draft := config.drafts() != draftsAnalyze && isDraftPullRequest()
+	if draft && config.drafts() == draftsSkip {
+		fmt.Println("Skipping: the pull request is a draft.")
+		return
+	}
+	if draft {
+		fmt.Println("The pull request is a draft: reporting warnings only, without comments.")
+		quietForDraft(config)
+	}
+	readOnly := isForkPullRequest()
+	if readOnly {
+		fmt.Println("The pull request comes from a fork, so the token is read-only: reporting through workflow annotations and the job summary.")
+	}
 
-	rules, err := readRulesFile(rulesPath)
+	rules, err := readFile(rulesPath)
+	if err == nil && strings.TrimSpace(rules) == "" {
+		err = fmt.Errorf("%s is empty", rulesPath)
+	}
+	if err != nil && !config.requiresRules() {
+		fmt.Printf("Warning: %v. Using the built-in default rules.\n", err)
+		rules, err = defaultRules, nil
+	}
 	if err != nil {
 		fmt.Printf("Error reading rules file: %v\n", err)
 		os.Exit(1)
 	}
+	if err := validateRulesScopes(rules); err != nil {
+		fmt.Printf("Error in rules file: %v\n", err)
+		os.Exit(1)
+	}
 
-	var provider LLMProvider
-	switch config.AI.Provider {
-	case "gemini":
-		provider = &GeminiProvider{Config: config.AI.Gemini}
-	case "openai":
-		provider = &OpenAIProvider{Config: config.AI.OpenAI}
-	case "anthropic":
-		provider = &AnthropicProvider{Config: config.AI.Anthropic}
+	if commits != nil && (combine || jobID != "") {
+		fmt.Println("Error: matrix jobs and combining results need a pull request.")
+		os.Exit(1)
+	}
+	if commits != nil && !config.Check.Enabled && !config.Status.Enabled && os.Getenv("INPUT_REPORT-TO") != "issue" {
+		fmt.Println("Error: without a pull request to comment on, check.enabled, status.enabled or report-to: issue must be set to report the results.")
+		os.Exit(1)
+	}
+
+	if err := validateCheckConclusions(config.Check.Conclusions); err != nil {
+		fmt.Printf("Error in check.conclusions: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch config.Comment.update() {
+	case commentUpdateEdit, commentUpdateAppend, commentUpdateRecreate:
 	default:
-		fmt.Printf("Unsupported AI provider: %s\n", config.AI.Provider)
+		fmt.Printf("Error in comment.update: unsupported value %q (want update, append or recreate)\n", config.Comment.Update)
+		os.Exit(1)
+	}
+	switch config.Comment.WhenClean {
+	case "", whenCleanComment, whenCleanSilent:
+	default:
+		fmt.Printf("Error in comment.whenClean: unsupported value %q (want comment or silent)\n", config.Comment.WhenClean)
+		os.Exit(1)
+	}
+	switch config.Comment.stale() {
+	case staleKeep, staleMinimize, staleDelete:
+	default:
+		fmt.Printf("Error in comment.stale: unsupported value %q (want keep, minimize or delete)\n", config.Comment.Stale)
 		os.Exit(1)
 	}
 
-	fmt.Println("Config and rules loaded successfully.")
+	switch config.AI.onProviderError() {
+	case providerErrorNote, providerErrorSkip, providerErrorFail:
+	default:
+		fmt.Printf("Error in ai.onProviderError: unsupported value %q (want note, skip or fail)\n", config.AI.OnProviderError)
+		os.Exit(1)
+	}
 
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: githubToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	if err := validatePatterns(config.AI.ModelByPath); err != nil {
+		fmt.Printf("Error in ai.modelByPath: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateModelRoutes(config.AI.ModelRoutes); err != nil {
+		fmt.Printf("Error in ai.modelRoutes: %v\n", err)
+		os.Exit(1)
+	}
 
-	prNumber, err := getPullRequestNumber()
+	mappedRules, err := loadMappedRules(config.RulesMap, readFile)
 	if err != nil {
-		fmt.Printf("Error getting pull request number: %v\n", err)
+		fmt.Printf("Error reading mapped rules files: %v\n", err)
 		os.Exit(1)
 	}
 
-	owner, repo := getRepoInfo()
+	provider, err := newProvider(config)
+	if err != nil {
+		fmt.Printf("Error creating AI provider: %v\n", err)
+		os.Exit(1)
+	}
+	if aiAPIKey == "" && !combine && !authenticatesWithoutKey(provider) {
+		if readOnly {
+			// Not a misconfiguration, so the fork's checks don't fail.
+			fmt.Println("::warning::Skipping: GitHub passes no secrets to pull_request runs from forks, so the AI API key is not set and nothing can be analyzed. Use a provider that needs no key, with mode: post to publish the results, or run on pull_request_target.")
+			return
+		}
+		fmt.Println("AI API key is not set.")
+		os.Exit(1)
+	}
+
+	fmt.Println("Config and rules loaded successfully.")
 
-	fmt.Printf("Fetching changed files for PR #%d in %s/%s\n", prNumber, owner, repo)
+	if combine {
+		results, jobComments, err := collectJobResults(ctx, client, owner, repo, prNumber, config)
+		if err != nil {
+			fmt.Printf("Error collecting job results: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Combining results from %d job(s).\n", len(jobComments))
+		previous, err := findSummaryComment(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			fmt.Printf("Error looking up previous results: %v\n", err)
+			os.Exit(1)
+		}
+		combined := &Report{Results: results}
+		if config.Comment.Permalinks {
+			combined.HeadSHA, err = getPullRequestHead(ctx, client, owner, repo, prNumber)
+			if err != nil {
+				fmt.Printf("Error getting pull request head: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := setResultOutputs(combined, config); err != nil {
+			fmt.Printf("Error setting result outputs: %v\n", err)
+		}
+		if err := writeMarkdownReport(os.Getenv("INPUT_REPORT-MD"), combined, config); err != nil {
+			fmt.Printf("Error writing Markdown report: %v\n", err)
+		}
+		if err := writeSARIFReport(os.Getenv("INPUT_SARIF"), combined, config); err != nil {
+			fmt.Printf("Error writing SARIF report: %v\n", err)
+		}
+		if err := writeResultsArtifact(os.Getenv("INPUT_RESULTS-ARTIFACT"), combined, config, prNumber, nil); err != nil {
+			fmt.Printf("Error writing results artifact: %v\n", err)
+		}
+		if getBoolInput("JOB-SUMMARY") || readOnly {
+			if err := writeJobSummary(combined, config); err != nil {
+				fmt.Printf("Error writing job summary: %v\n", err)
+			}
+		}
+		if getBoolInput("WORKFLOW-ANNOTATIONS") || draft || readOnly {
+			printWorkflowAnnotations(combined.Results, config, draft)
+		}
+		if !readOnly {
+			// Inline comments and the drift baseline need the
+			// patches, which the job results don't carry.
+			changedFiles, _, err := getChangedFiles(ctx, client, owner, repo, prNumber)
+			if err != nil {
+				fmt.Printf("Error getting changed files: %v\n", err)
+				os.Exit(1)
+			}
+			publisher := &Publisher{
+				Client:      client,
+				Owner:       owner,
+				Repo:        repo,
+				PRNumber:    prNumber,
+				Config:      config,
+				Previous:    previous,
+				Patches:     make(map[string]string, len(changedFiles)),
+				ReportTo:    os.Getenv("INPUT_REPORT-TO"),
+				UploadSARIF: getBoolInput("UPLOAD-SARIF"),
+				DryRun:      getBoolInput("DRY-RUN"),
+			}
+			for _, file := range changedFiles {
+				publisher.Patches[file.Filename] = file.Patch
+			}
+			if err := publisher.Publish(ctx, combined); err != nil {
+				fmt.Printf("Error posting results: %v\n", err)
+				os.Exit(1)
+			}
+			if err := deleteComments(ctx, client, owner, repo, jobComments); err != nil {
+				fmt.Printf("Error removing job comments: %v\n", err)
+			}
+		}
+		if hasErrors(results, config) && !draft {
+			os.Exit(1)
+		}
+		return
+	}
 
-	changedFiles, err := getChangedFiles(ctx, client, owner, repo, prNumber)
+	var changedFiles, binaryFiles []*ChangedFile
+	if mode == modeFullScan {
+		fmt.Printf("Scanning every file of the checkout of %s/%s\n", owner, repo)
+		changedFiles, err = scanWorkingTree(".")
+	} else if commits != nil {
+		fmt.Printf("Fetching files changed between %s and %s in %s/%s\n", commits.Base, commits.Head, owner, repo)
+		changedFiles, binaryFiles, err = getRangeChangedFiles(ctx, client, owner, repo, commits)
+	} else {
+		fmt.Printf("Fetching changed files for PR #%d in %s/%s\n", prNumber, owner, repo)
+	}
+	if commits == nil && config.AuthorChangesOnly {
+		changedFiles, binaryFiles, err = getAuthorChangedFiles(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			fmt.Printf("Could not diff against the merge base, using the pull request file list: %v\n", err)
+		}
+	}
+	if commits == nil && (!config.AuthorChangesOnly || err != nil) {
+		changedFiles, binaryFiles, err = getChangedFiles(ctx, client, owner, repo, prNumber)
+	}
 	if err != nil {
 		fmt.Printf("Error getting changed files: %v\n", err)
 		os.Exit(1)
@@ -413,34 +1283,337 @@ func main() {
 		os.Exit(1)
 	}
 
+	warnExcessiveExclusion(changedFiles, filesToAnalyze, config)
+	if command != nil {
+		filesToAnalyze, err = command.filter(filesToAnalyze)
+		if err != nil {
+			fmt.Printf("Error filtering files: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	filesToAnalyze = filterSmallPatches(filesToAnalyze, config.Limits)
+	if config.OwnedBy != "" {
+		owners, err := loadCodeowners(readFile)
+		if err != nil {
+			fmt.Printf("Error reading CODEOWNERS for ownedBy: %v\n", err)
+			os.Exit(1)
+		}
+		filesToAnalyze = filterOwnedFiles(filesToAnalyze, owners, config.OwnedBy)
+	}
+	if shardTotal > 1 {
+		total := len(filesToAnalyze)
+		filesToAnalyze = shardFiles(filesToAnalyze, shardIndex, shardTotal)
+		fmt.Printf("Shard %d of %d: taking %d of %d file(s).\n", shardIndex, shardTotal, len(filesToAnalyze), total)
+	}
+
 	fmt.Printf("Found %d files to analyze.\n", len(filesToAnalyze))
+	if mode == modeFullScan {
+		filesToAnalyze = chunkFiles(filesToAnalyze, config.FullScan.chunkLines())
+		fmt.Printf("Sending them in %d chunk(s).\n", len(filesToAnalyze))
+	}
 
-	var results []*FileAnalysisResult
-	for _, file := range filesToAnalyze {
-		analysis, err := analyzePatch(file.Patch, config, rules, aiAPIKey, provider)
+	// Files analyzed successfully by a previous run at the same SHA are not
+	// sent to the model again unless a full re-run is forced.
+	var previous *github.IssueComment
+	var reused []*FileAnalysisResult
+	if jobID == "" && commits == nil {
+		previous, err = findSummaryComment(ctx, client, owner, repo, prNumber)
 		if err != nil {
-			fmt.Printf("Error analyzing patch for %s: %v\n", file.Filename, err)
-			continue
+			fmt.Printf("Error looking up previous results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if config.Feedback.Enabled && jobID == "" && commits == nil {
+		byType, summary, err := collectFeedback(ctx, client, owner, repo, prNumber, previous)
+		if err == nil {
+			err = writeStepSummary(renderFeedbackReport(byType, summary))
+		}
+		if err != nil {
+			fmt.Printf("Error reporting feedback: %v\n", err)
+		}
+	}
+
+	if previous != nil && !getBoolInput("FORCE-FULL-RUN") {
+		filesToAnalyze, reused, err = reusePreviousResults(previous.GetBody(), filesToAnalyze)
+		if err != nil {
+			fmt.Printf("Ignoring unreadable previous results: %v\n", err)
+		}
+		fmt.Printf("Reusing previous results for %d file(s), analyzing %d.\n", len(reused), len(filesToAnalyze))
+	}
+
+	diag, err := openDiagnosticWriter(os.Getenv("INPUT_JSONL"))
+	if err != nil {
+		fmt.Printf("Error opening JSONL output: %v\n", err)
+		os.Exit(1)
+	}
+	defer diag.Close()
+
+	analyzer := &Analyzer{
+		Config:      config,
+		Rules:       rules,
+		MappedRules: mappedRules,
+		APIKey:      aiAPIKey,
+		Provider:    provider,
+		Diag:        diag,
+	}
+	analyzer.RepoContext, err = loadRepoContext(config.AI, readFile)
+	if err != nil {
+		fmt.Printf("Error reading repository context: %v\n", err)
+		os.Exit(1)
+	}
+	if config.PackageConfigs {
+		analyzer.Packages, err = discoverPackageConfigs(filesToAnalyze, configPath, readFile)
+		if err != nil {
+			fmt.Printf("Error reading package configs: %v\n", err)
+			os.Exit(1)
+		}
+		for dir := range analyzer.Packages {
+			fmt.Printf("Using the package config of %s.\n", dir)
+		}
+	}
+	if analyzer.RepoContext != "" {
+		hash := contentHash(analyzer.RepoContext)
+		fmt.Printf("Using %d bytes of repository context (sha256 %s).\n", len(analyzer.RepoContext), hash)
+		if err := setOutput("repo-context-hash", hash); err != nil {
+			fmt.Printf("Error writing repo-context-hash output: %v\n", err)
+		}
+	}
+	if config.AI.ContextRequests.Enabled {
+		headSHA, err := headCommit(ctx, client, owner, repo, prNumber, commits)
+		if err != nil {
+			fmt.Printf("Error getting pull request head: %v\n", err)
+			os.Exit(1)
+		}
+		analyzer.FetchFile = func(ctx context.Context, path string) (string, error) {
+			return getFileContent(ctx, client, owner, repo, path, headSHA)
+		}
+	}
+	if config.Docs.Enabled {
+		analyzer.DocsRules, err = readFile(config.Docs.RulesFile)
+		if err == nil {
+			err = validateRulesScopes(analyzer.DocsRules)
+		}
+		if err != nil {
+			fmt.Printf("Error reading docs rules file: %v\n", err)
+			os.Exit(1)
 		}
-		results = append(results, &FileAnalysisResult{
-			Filename: file.Filename,
-			Issues:   analysis.Issues,
+	}
+
+	report := analyzer.AnalyzeFiles(ctx, filesToAnalyze)
+
+	// The root context may be cancelled by now, so the partial results are
+	// post-processed and posted on a context of their own.
+	postCtx, cancel := afterCancelGrace(ctx)
+	defer cancel()
+
+	if err := completeReport(postCtx, report, config, changedFiles, reused); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if config.ValidateSuggestions {
+		headSHA, err := headCommit(postCtx, client, owner, repo, prNumber, commits)
+		if err != nil {
+			fmt.Printf("Error getting pull request head: %v\n", err)
+			os.Exit(1)
+		}
+		report.SuggestionsDropped = validateSuggestions(postCtx, report.Results, func(ctx context.Context, path string) (string, error) {
+			return getFileContent(ctx, client, owner, repo, path, headSHA)
 		})
+		fmt.Printf("Dropped %d suggestion(s) that did not parse.\n", report.SuggestionsDropped)
 	}
 
-	err = postResults(ctx, client, owner, repo, prNumber, results, config)
+	if config.Comment.Permalinks {
+		report.HeadSHA, err = headCommit(postCtx, client, owner, repo, prNumber, commits)
+		if err != nil {
+			fmt.Printf("Error getting pull request head: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if config.AI.StrictJSON {
+		fmt.Printf("%d response(s) were not pure JSON.\n", report.FormatViolations)
+		if err := setOutput("format-violations", strconv.Itoa(report.FormatViolations)); err != nil {
+			fmt.Printf("Error setting format-violations output: %v\n", err)
+		}
+	}
+	if report.Interrupted {
+		fmt.Println("Run interrupted, posting partial results.")
+	}
+	if config.Scoring.Enabled {
+		score := computeScore(report.Results, config)
+		report.Score = &score
+		fmt.Printf("Score: %d/100\n", score)
+		if err := setOutput("score", strconv.Itoa(score)); err != nil {
+			fmt.Printf("Error setting score output: %v\n", err)
+		}
+	}
+	if err := setResultOutputs(report, config); err != nil {
+		fmt.Printf("Error setting result outputs: %v\n", err)
+	}
+	if report.BudgetReached {
+		if err := writeStepSummary(renderBudgetBanner(report, config)); err != nil {
+			fmt.Printf("Error writing step summary: %v\n", err)
+		}
+	}
+
+	if jobID != "" && getBoolInput("DRY-RUN") {
+		fmt.Printf("Dry run: not storing results for job %s.\n", jobID)
+	} else if jobID != "" {
+		fmt.Printf("Storing results for job %s for a later combine step.\n", jobID)
+		err = postJobResults(postCtx, client, owner, repo, prNumber, jobID, report.Results)
+	} else {
+		if config.ReportBinaryFiles {
+			report.BinaryFiles, err = filterBinaryFiles(binaryFiles, config)
+			if err != nil {
+				fmt.Printf("Error filtering binary files: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// Written before posting so the report exists even when the
+		// comment can't be posted, e.g. on pull requests from forks.
+		if err := writeMarkdownReport(os.Getenv("INPUT_REPORT-MD"), report, config); err != nil {
+			fmt.Printf("Error writing Markdown report: %v\n", err)
+		}
+		if err := writeSARIFReport(os.Getenv("INPUT_SARIF"), report, config); err != nil {
+			fmt.Printf("Error writing SARIF report: %v\n", err)
+		}
+		if err := writeResultsArtifact(os.Getenv("INPUT_RESULTS-ARTIFACT"), report, config, prNumber, provider); err != nil {
+			fmt.Printf("Error writing results artifact: %v\n", err)
+		}
+		if getBoolInput("JOB-SUMMARY") || readOnly {
+			if err := writeJobSummary(report, config); err != nil {
+				fmt.Printf("Error writing job summary: %v\n", err)
+			}
+		}
+		if getBoolInput("WORKFLOW-ANNOTATIONS") || draft || readOnly {
+			printWorkflowAnnotations(report.Results, config, draft)
+		}
+		if !readOnly {
+			publisher := &Publisher{
+				Client:      client,
+				Owner:       owner,
+				Repo:        repo,
+				PRNumber:    prNumber,
+				Config:      config,
+				Previous:    previous,
+				Patches:     make(map[string]string, len(changedFiles)),
+				ReportTo:    os.Getenv("INPUT_REPORT-TO"),
+				UploadSARIF: getBoolInput("UPLOAD-SARIF"),
+				DryRun:      getBoolInput("DRY-RUN"),
+			}
+			if commits != nil {
+				publisher.HeadSHA, publisher.Ref = commits.Head, commits.Ref
+			}
+			for _, file := range changedFiles {
+				publisher.Patches[file.Filename] = file.Patch
+			}
+			err = publisher.Publish(postCtx, report)
+		}
+	}
 	if err != nil {
 		fmt.Printf("Error posting results: %v\n", err)
 		os.Exit(1)
 	}
 
-	if hasErrors(results, config) {
+	if len(report.Failed) > 0 && config.AI.onProviderError() == providerErrorFail {
+		fmt.Printf("Failing: the AI provider could not analyze %d file(s).\n", len(report.Failed))
+		os.Exit(1)
+	}
+	if report.Interrupted || (hasErrors(report.Results, config) && !draft) {
 		os.Exit(1)
 	}
 }
 
-func loadConfig(path string) (*Config, error) {
-	content, err := os.ReadFile(path)
+// newProvider builds the configured provider, wrapped in a fallback chain
+// when ai.fallback lists more, and in a consensus group when
+// ai.consensus.providers does.
+func newProvider(config *Config) (LLMProvider, error) {
+	provider, err := newNamedProvider(config.AI.Provider, config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.AI.Fallback) > 0 {
+		provider, err = newFallbackProvider(provider, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.AI.Consensus.Providers) > 0 {
+		return newConsensusProvider(provider, config)
+	}
+	return provider, nil
+}
+
+// newNamedProvider builds the LLM provider of the given name. Its HTTP
+// client carries the configured gateway headers.
+func newNamedProvider(name string, config *Config) (LLMProvider, error) {
+	transport := &stallTransport{base: newHeaderTransport(http.DefaultTransport, config.AI.Headers), timeout: config.AI.Deadline.stallTimeout()}
+	httpClient := &http.Client{Transport: transport}
+	stream := config.AI.Deadline.streaming()
+
+	switch name {
+	case "gemini":
+		provider := &GeminiProvider{Config: config.AI.Gemini, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}
+		if config.AI.Gemini.CacheRules {
+			provider.rulesCache = &geminiRulesCache{names: make(map[string]string)}
+		}
+		if config.AI.Gemini.Vertex != nil {
+			tokens, err := vertexTokenSource(context.Background(), config.AI.Gemini.Vertex)
+			if err != nil {
+				return nil, err
+			}
+			if tokens != nil {
+				provider.TokenSource = oauth2.ReuseTokenSource(nil, tokens)
+			}
+		}
+		return provider, nil
+	case "openai":
+		return &OpenAIProvider{Config: config.AI.OpenAI, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "anthropic":
+		return &AnthropicProvider{Config: config.AI.Anthropic, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "azure-openai":
+		return &AzureOpenAIProvider{Config: config.AI.AzureOpenAI, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "cohere":
+		return &CohereProvider{Config: config.AI.Cohere, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient}, nil
+	case "ollama":
+		return &OllamaProvider{Config: config.AI.Ollama, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient}, nil
+	case "openai-compatible":
+		return &OpenAICompatibleProvider{Config: config.AI.OpenAICompatible, MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "mistral":
+		return &OpenAIProvider{Config: config.AI.Mistral.withDefaults(defaultMistralEndpoint, defaultMistralModel), MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "groq":
+		return &OpenAIProvider{Config: config.AI.Groq.withDefaults(defaultGroqEndpoint, defaultGroqModel), MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "grok":
+		return &OpenAIProvider{Config: config.AI.Grok.withDefaults(defaultGrokEndpoint, defaultGrokModel), MaxOutputTokens: config.AI.MaxOutputTokens, HTTPClient: httpClient, Stream: stream}, nil
+	case "exec":
+		return &ExecProvider{Config: config.AI.Exec, MaxOutputTokens: config.AI.MaxOutputTokens}, nil
+	default:
+		return nil, fmt.Errorf("unsupported AI provider: %s", name)
+	}
+}
+
+// authenticatesWithoutKey reports whether a provider needs no API key,
+// because it has credentials of its own, such as a Vertex AI service
+// account, or is self-hosted.
+func authenticatesWithoutKey(provider LLMProvider) bool {
+	switch p := provider.(type) {
+	case *GeminiProvider:
+		return p.TokenSource != nil
+	case *OllamaProvider, *OpenAICompatibleProvider, *ExecProvider:
+		return true
+	case *FallbackProvider:
+		return authenticatesWithoutKey(p.Chain[0].Provider)
+	case *ConsensusProvider:
+		return authenticatesWithoutKey(p.Members[0].Provider)
+	}
+	return false
+}
+
+// parseConfig parses a config file, as YAML or JSON by the extension of
+// configPath.
+func parseConfig(configPath string, content []byte) (*Config, error) {
+	content, err := configJSON(configPath, content)
 	if err != nil {
 		return nil, err
 	}
@@ -449,15 +1622,11 @@ func loadConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &config, nil
-}
-
-func readRulesFile(path string) (string, error) {
-	content, err := os.ReadFile(path)
+	config.AI.PromptTemplate, err = expandTemplateVars(config.AI)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(content), nil
+	return &config, nil
 }
 
 func getRepoInfo() (string, string) {
@@ -466,22 +1635,107 @@ func getRepoInfo() (string, string) {
 	return parts[0], parts[1]
 }
 
-func getChangedFiles(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*ChangedFile, error) {
-	files, _, err := client.PullRequests.ListFiles(ctx, owner, repo, prNumber, nil)
+// getPullRequestHead returns the SHA of the pull request's head commit.
+func getPullRequestHead(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (string, error) {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNumber)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	return pr.GetHead().GetSHA(), nil
+}
+
+// getFileContent returns the content of a file at the given ref.
+func getFileContent(ctx context.Context, client *github.Client, owner, repo, path, ref string) (string, error) {
+	file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		return "", err
 	}
+	if file == nil {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	return file.GetContent()
+}
 
-	var changedFiles []*ChangedFile
+// maxPullRequestFiles is the most files GitHub lists for a pull request.
+const maxPullRequestFiles = 3000
+
+// getChangedFiles returns the files with a textual patch, and separately the
+// files GitHub reports without one (binaries, images), which are never sent
+// to the model.
+func getChangedFiles(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*ChangedFile, []*ChangedFile, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var files []*github.CommitFile
+	for {
+		page, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if len(files) >= maxPullRequestFiles {
+		fmt.Printf("::warning::GitHub lists at most %d changed files for pull request #%d; any further files are not analyzed.\n", maxPullRequestFiles, prNumber)
+	}
+	changedFiles, binaryFiles := splitCommitFiles(files)
+	return changedFiles, binaryFiles, nil
+}
+
+// getAuthorChangedFiles returns the changes the pull request's own commits
+// make, by comparing its head against the merge base with the base branch.
+// Code the branch picked up by merging the base branch is not included.
+func getAuthorChangedFiles(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*ChangedFile, []*ChangedFile, error) {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	headSHA := pr.GetHead().GetSHA()
+
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, repo, pr.GetBase().GetSHA(), headSHA, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	mergeBase := comparison.GetMergeBaseCommit().GetSHA()
+	if mergeBase == "" {
+		return nil, nil, fmt.Errorf("no merge base between %s and %s", pr.GetBase().GetSHA(), headSHA)
+	}
+
+	comparison, _, err = client.Repositories.CompareCommits(ctx, owner, repo, mergeBase, headSHA, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(comparison.Files) >= maxCompareFiles {
+		fmt.Printf("::warning::GitHub lists at most %d changed files for %s..%s; any further files are not analyzed.\n", maxCompareFiles, mergeBase, headSHA)
+	}
+	changedFiles, binaryFiles := splitCommitFiles(comparison.Files)
+	return changedFiles, binaryFiles, nil
+}
+
+// splitCommitFiles converts GitHub's file list into files with a textual
+// patch and files without one.
+func splitCommitFiles(files []*github.CommitFile) ([]*ChangedFile, []*ChangedFile) {
+	var changedFiles, binaryFiles []*ChangedFile
 	for _, file := range files {
-		if file.Filename != nil && file.Patch != nil {
-			changedFiles = append(changedFiles, &ChangedFile{
+		if file.Filename == nil {
+			continue
+		}
+		if file.Patch == nil {
+			binaryFiles = append(binaryFiles, &ChangedFile{
 				Filename: *file.Filename,
-				Patch:    *file.Patch,
+				Status:   file.GetStatus(),
 			})
+			continue
 		}
+		changedFiles = append(changedFiles, &ChangedFile{
+			Filename: *file.Filename,
+			Patch:    *file.Patch,
+			Status:   file.GetStatus(),
+			SHA:      file.GetSHA(),
+		})
 	}
-	return changedFiles, nil
+	return changedFiles, binaryFiles
 }
 
 func filterFiles(files []*ChangedFile, config *Config) ([]*ChangedFile, error) {
@@ -507,6 +1761,62 @@ func filterFiles(files []*ChangedFile, config *Config) ([]*ChangedFile, error) {
 	return filteredFiles, nil
 }
 
+const defaultExclusionWarningPercent = 80
+
+// warnExcessiveExclusion flags runs where the patterns filtered out most of
+// the changed source files, which usually means a glob is wrong and the
+// linter is silently doing nothing. Source files are those in a language
+// detectLanguage knows.
+func warnExcessiveExclusion(changed, kept []*ChangedFile, config *Config) {
+	threshold := config.ExclusionWarningPercent
+	if threshold == 0 {
+		threshold = defaultExclusionWarningPercent
+	}
+
+	isKept := make(map[string]bool, len(kept))
+	for _, file := range kept {
+		isKept[file.Filename] = true
+	}
+	var source int
+	var excluded []string
+	for _, file := range changed {
+		if detectLanguage(file.Filename) == "" {
+			continue
+		}
+		source++
+		if !isKept[file.Filename] {
+			excluded = append(excluded, file.Filename)
+		}
+	}
+	if source == 0 || len(excluded)*100 <= source*threshold {
+		return
+	}
+
+	examples := excluded
+	if len(examples) > 3 {
+		examples = examples[:3]
+	}
+	fmt.Printf("::warning::%d of %d changed source files were excluded from analysis, e.g. %s. "+
+		"Check the patterns: includedFiles=%v, excludedFiles=%v.\n",
+		len(excluded), source, strings.Join(examples, ", "), config.IncludedFiles, config.ExcludedFiles)
+}
+
+// filterBinaryFiles drops binary files matching the excluded patterns. The
+// included patterns are not applied since they usually name source files.
+func filterBinaryFiles(files []*ChangedFile, config *Config) ([]*ChangedFile, error) {
+	var filteredFiles []*ChangedFile
+	for _, file := range files {
+		excluded, err := matchAny(file.Filename, config.ExcludedFiles)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			filteredFiles = append(filteredFiles, file)
+		}
+	}
+	return filteredFiles, nil
+}
+
 func matchAny(path string, patterns []string) (bool, error) {
 	for _, pattern := range patterns {
 		match, err := doublestar.Match(pattern, path)
@@ -520,57 +1830,90 @@ func matchAny(path string, patterns []string) (bool, error) {
 	return false, nil
 }
 
-func analyzePatch(patch string, config *Config, rules, apiKey string, provider LLMProvider) (*AnalysisResult, error) {
-	prompt := strings.Replace(config.AI.PromptTemplate, "{rules}", rules, 1)
-	prompt = strings.Replace(prompt, "{code}", patch, 1)
-
-	return provider.Analyze(patch, prompt, apiKey)
-}
+// postResults writes the summary comment, editing the previous run's comment
+// in place when there is one.
+func postResults(ctx context.Context, client *github.Client, owner, repo string, prNumber int, report *Report, config *Config, previous *github.IssueComment) error {
+	// An earlier comment listing issues is still updated, so it doesn't
+	// keep showing issues that are gone.
+	if report.clean() && config.Comment.WhenClean == whenCleanSilent && previous == nil {
+		fmt.Println("No issues found, not posting a comment.")
+		return nil
+	}
 
-func postResults(ctx context.Context, client *github.Client, owner, repo string, prNumber int, results []*FileAnalysisResult, config *Config) error {
-	var comment strings.Builder
-	comment.WriteString("## Semantic Linting Results\n\n")
+	parts, err := renderSummaryParts(report, config)
+	if err != nil {
+		return err
+	}
+	commentString := parts[0]
 
-	for _, result := range results {
-		if len(result.Issues) > 0 {
-			comment.WriteString(fmt.Sprintf("### %s\n\n", result.Filename))
-			for _, issue := range result.Issues {
-				severityIcon := "⚠️"
-				for _, errorType := range config.Severity.Error {
-					if issue.Type == errorType {
-						severityIcon = "🔴"
-						break
-					}
-				}
-				comment.WriteString(fmt.Sprintf("%s **%s**: %s\n", severityIcon, issue.Type, issue.Message))
-				if issue.Suggestion != "" {
-					comment.WriteString(fmt.Sprintf("> Suggestion: %s\n", issue.Suggestion))
-				}
-				comment.WriteString("\n")
+	if previous != nil {
+		switch config.Comment.update() {
+		case commentUpdateEdit:
+			_, _, err = client.Issues.EditComment(ctx, owner, repo, previous.GetID(), &github.IssueComment{
+				Body: &commentString,
+			})
+			if err != nil {
+				return err
+			}
+			return postContinuations(ctx, client, owner, repo, prNumber, parts[1:], config)
+		case commentUpdateRecreate:
+			if _, err := client.Issues.DeleteComment(ctx, owner, repo, previous.GetID()); err != nil {
+				return fmt.Errorf("failed to delete previous comment: %w", err)
 			}
 		}
 	}
 
-	commentString := comment.String()
-	_, _, err := client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{
 		Body: &commentString,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	return postContinuations(ctx, client, owner, repo, prNumber, parts[1:], config)
+}
+
+// renderSummaryComment renders the full body of the summary comment,
+// including the hidden marker and state used by later runs.
+func renderSummaryComment(report *Report, config *Config) (string, error) {
+	state, err := encodeHiddenData("state", report.Results)
+	if err != nil {
+		return "", err
+	}
+	return summaryMarker + "\n" + renderComment(report, config) + state + "\n", nil
 }
 
 func hasErrors(results []*FileAnalysisResult, config *Config) bool {
 	for _, result := range results {
 		for _, issue := range result.Issues {
-			for _, errorType := range config.Severity.Error {
-				if issue.Type == errorType {
-					return true
-				}
+			if issueSeverity(issue, config) == "error" {
+				return true
 			}
 		}
 	}
 	return false
 }
 
+// issueSeverity returns the severity already assigned to an issue, or
+// classifies it as "error" when its type is listed under severity.error in
+// the config and as "warning" otherwise.
+func issueSeverity(issue Issue, config *Config) string {
+	if issue.Severity != "" {
+		return issue.Severity
+	}
+	for _, errorType := range config.Severity.Error {
+		if issue.Type == errorType {
+			return "error"
+		}
+	}
+	return "warning"
+}
+
+// getBoolInput reports whether the named action input is set to a true value.
+func getBoolInput(name string) bool {
+	value, err := strconv.ParseBool(os.Getenv("INPUT_" + name))
+	return err == nil && value
+}
+
 func getPullRequestNumber() (int, error) {
 	prNumberStr := os.Getenv("INPUT_PR-NUMBER")
 	if prNumberStr != "" {
@@ -590,19 +1933,27 @@ func getPullRequestNumber() (int, error) {
 		return 0, fmt.Errorf("failed to read event file: %w", err)
 	}
 
+	// Comment events carry the pull request as an issue.
 	var payload struct {
 		PullRequest struct {
 			Number int `json:"number"`
 		} `json:"pull_request"`
+		Issue struct {
+			Number      int       `json:"number"`
+			PullRequest *struct{} `json:"pull_request"`
+		} `json:"issue"`
 	}
 
 	if err := json.Unmarshal(data, &payload); err != nil {
 		return 0, fmt.Errorf("failed to unmarshal event payload: %w", err)
 	}
 
+	if payload.PullRequest.Number == 0 && payload.Issue.PullRequest != nil {
+		return payload.Issue.Number, nil
+	}
 	if payload.PullRequest.Number == 0 {
 		return 0, fmt.Errorf("pull request number not found in event payload")
 	}
 
 	return payload.PullRequest.Number, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OllamaConfig configures a self-hosted Ollama server, so diffs never leave
+// the network it runs in.
+type OllamaConfig struct {
+	// BaseURL defaults to http://localhost:11434.
+	BaseURL    string            `json:"baseUrl"`
+	Model      string            `json:"model"`
+	Headers    map[string]string `json:"headers"`
+	Generation GenerationParams  `json:"generation"`
+}
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+type OllamaProvider struct {
+	Config          OllamaConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+}
+
+type OllamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []OpenAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	// Format "json" constrains the output to valid JSON.
+	Format  string         `json:"format"`
+	Options *OllamaOptions `json:"options,omitempty"`
+}
+
+type OllamaOptions struct {
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type OllamaResponse struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	DoneReason string `json:"done_reason"`
+}
+
+func (p *OllamaProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	if p.Config.Model == "" {
+		return nil, fmt.Errorf("ai.ollama.model is required")
+	}
+	ollamaReq := OllamaRequest{
+		Model:    p.Config.Model,
+		Messages: []OpenAIMessage{{Role: "user", Content: prompt}},
+		Format:   "json",
+	}
+	generation := p.Config.Generation
+	ollamaReq.Options = &OllamaOptions{
+		NumPredict:  generation.maxOutputTokens(p.MaxOutputTokens),
+		Temperature: generation.Temperature,
+		TopP:        generation.TopP,
+		TopK:        generation.TopK,
+		Stop:        generation.StopSequences,
+	}
+
+	bodyBytes, err := json.Marshal(ollamaReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	baseURL := p.Config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(baseURL, "/")+"/api/chat", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setProviderHeaders(req, map[string]string{"Content-Type": "application/json"}, p.Config.Headers, apiKey)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %s: %s", resp.Status, string(body))
+	}
+
+	var ollamaResp OllamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if ollamaResp.DoneReason == "length" {
+		return nil, errOutputTruncated
+	}
+
+	return parseAnalysisResult(ollamaResp.Message.Content, "ollama")
+}
+
+func (p *OllamaProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
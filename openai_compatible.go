@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAICompatibleConfig configures any server that implements the OpenAI
+// chat completions API, such as LiteLLM, vLLM, OpenRouter or an internal
+// proxy.
+type OpenAICompatibleConfig struct {
+	// BaseURL is the API root, e.g. https://openrouter.ai/api/v1.
+	// Requests go to BaseURL + "/chat/completions".
+	BaseURL string `json:"baseUrl"`
+	Model   string `json:"model"`
+	// AuthHeader names the header carrying the API key. "Authorization"
+	// (default) sends it as a bearer token, any other header as is.
+	AuthHeader string            `json:"authHeader"`
+	Headers    map[string]string `json:"headers"`
+	Generation GenerationParams  `json:"generation"`
+}
+
+type OpenAICompatibleProvider struct {
+	Config          OpenAICompatibleConfig
+	MaxOutputTokens int
+	HTTPClient      *http.Client
+	Stream          bool
+}
+
+func (p *OpenAICompatibleProvider) Analyze(ctx context.Context, patch, prompt, apiKey string) (*AnalysisResult, error) {
+	if p.Config.BaseURL == "" || p.Config.Model == "" {
+		return nil, fmt.Errorf("ai.openaiCompatible.baseUrl and ai.openaiCompatible.model are required")
+	}
+
+	// The OpenAI provider's bearer header is dropped in favour of the
+	// configured one. Without a key, e.g. for an unauthenticated local
+	// server, no auth header is sent.
+	headers := map[string]string{"Authorization": ""}
+	if apiKey != "" {
+		authHeader := p.Config.AuthHeader
+		if authHeader == "" || strings.EqualFold(authHeader, "Authorization") {
+			headers["Authorization"] = "Bearer {{AI_API_KEY}}"
+		} else {
+			headers[authHeader] = "{{AI_API_KEY}}"
+		}
+	}
+	for key, value := range p.Config.Headers {
+		headers[key] = value
+	}
+
+	openAI := &OpenAIProvider{
+		Config: OpenAIConfig{
+			APIEndpoint: strings.TrimSuffix(p.Config.BaseURL, "/") + "/chat/completions",
+			Model:       p.Config.Model,
+			Headers:     headers,
+			Generation:  p.Config.Generation,
+		},
+		MaxOutputTokens: p.MaxOutputTokens,
+		HTTPClient:      p.HTTPClient,
+		Stream:          p.Stream,
+	}
+	return openAI.Analyze(ctx, patch, prompt, apiKey)
+}
+
+func (p *OpenAICompatibleProvider) WithModel(model string) LLMProvider {
+	clone := *p
+	clone.Config.Model = model
+	return &clone
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// resultsJSONName is the file in the runner's temp directory that the
+// results-json-path output points to.
+const resultsJSONName = "semantic-lint-results.json"
+
+// setResultOutputs sets the issue count outputs and writes the results as
+// JSON for later steps, e.g. to label the pull request or send
+// notifications based on what was found.
+func setResultOutputs(report *Report, config *Config) error {
+	errors, warnings := countSeverities(report.Results, config)
+	outputs := []struct{ name, value string }{
+		{"total-issues", strconv.Itoa(errors + warnings)},
+		{"error-count", strconv.Itoa(errors)},
+		{"warning-count", strconv.Itoa(warnings)},
+	}
+
+	path, err := writeResultsJSON(report.Results)
+	if err != nil {
+		return fmt.Errorf("failed to write results JSON: %w", err)
+	}
+	outputs = append(outputs, struct{ name, value string }{"results-json-path", path})
+
+	for _, output := range outputs {
+		if err := setOutput(output.name, output.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResultsJSON writes the results in the same shape as the
+// postProcessCommand input and returns the file's path.
+func writeResultsJSON(results []*FileAnalysisResult) (string, error) {
+	dir := os.Getenv("RUNNER_TEMP")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if results == nil {
+		results = []*FileAnalysisResult{}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, resultsJSONName)
+	return path, os.WriteFile(path, data, 0o644)
+}
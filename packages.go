@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// PackageConfig is a config file inside a package of a monorepo, found at
+// the same relative path as the root config, e.g.
+// services/api/.github/semantic-lint.config.json. It applies to the files
+// below its package directory; the nearest one up a file's path wins.
+type PackageConfig struct {
+	// Rules is a rules file, relative to the package directory, that
+	// replaces the rules for the package's files.
+	Rules string `json:"rules"`
+	// Instructions are added to the rules for the package's files, e.g.
+	// what the package does or conventions only it follows.
+	Instructions string `json:"instructions"`
+
+	dir   string
+	rules string
+}
+
+// discoverPackageConfigs looks up the package configs that apply to the
+// files, keyed by package directory. Every directory on a file's path
+// except the repository root is checked once; a directory without a config
+// file is skipped.
+func discoverPackageConfigs(files []*ChangedFile, configPath string, readFile fileReader) (map[string]*PackageConfig, error) {
+	packages := make(map[string]*PackageConfig)
+	checked := make(map[string]bool)
+	for _, file := range files {
+		for dir := path.Dir(file.Filename); dir != "." && dir != "/" && !checked[dir]; dir = path.Dir(dir) {
+			checked[dir] = true
+			content, err := readFile(path.Join(dir, configPath))
+			if err != nil {
+				continue
+			}
+			var pkg PackageConfig
+			data, err := configJSON(configPath, []byte(content))
+			if err == nil {
+				err = json.Unmarshal(data, &pkg)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path.Join(dir, configPath), err)
+			}
+			pkg.dir = dir
+			if pkg.Rules != "" {
+				pkg.rules, err = readFile(path.Join(dir, pkg.Rules))
+				if err != nil {
+					return nil, fmt.Errorf("failed to read rules of package %s: %w", dir, err)
+				}
+				if err := validateRulesScopes(pkg.rules); err != nil {
+					return nil, fmt.Errorf("rules of package %s: %w", dir, err)
+				}
+			}
+			packages[dir] = &pkg
+		}
+	}
+	return packages, nil
+}
+
+// packageFor returns the nearest package config up a file's path, or nil.
+func (a *Analyzer) packageFor(filename string) *PackageConfig {
+	for dir := path.Dir(filename); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if pkg, ok := a.Packages[dir]; ok {
+			return pkg
+		}
+	}
+	return nil
+}
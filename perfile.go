@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// In "per-file" comment mode every file with issues gets its own comment,
+// tagged with a marker naming the file, so notifications can be routed per
+// file. Re-runs edit these comments in place.
+const fileMarkerPrefix = "<!-- semantic-lint:file="
+
+func fileMarker(filename string) string {
+	return fileMarkerPrefix + filename + " -->"
+}
+
+// fileCommentFilename returns the file a per-file comment is about, or ""
+// for other comments.
+func fileCommentFilename(body string) string {
+	if !strings.HasPrefix(body, fileMarkerPrefix) {
+		return ""
+	}
+	line, _, _ := strings.Cut(body, "\n")
+	return strings.TrimSuffix(strings.TrimPrefix(line, fileMarkerPrefix), " -->")
+}
+
+func renderFileComment(result *FileAnalysisResult, headSHA string, config *Config) string {
+	body := fileMarker(result.Filename) + "\n" +
+		"## Semantic Linting Results\n\n" +
+		renderDetails(&Report{Results: []*FileAnalysisResult{result}, HeadSHA: headSHA}, config)
+	return truncate(body, maxCommentLength)
+}
+
+func renderResolvedFileComment(filename string) string {
+	return fileMarker(filename) + "\n" +
+		"## Semantic Linting Results\n\n" +
+		fmt.Sprintf("✅ No issues remain in `%s`.\n", filename)
+}
+
+// postFileComments creates or updates one comment per file with issues. The
+// comment of a file that no longer has issues is updated to say so rather
+// than deleted, so its history stays readable. Comments on files this run
+// didn't analyze are left as they are.
+func postFileComments(ctx context.Context, client *github.Client, owner, repo string, prNumber int, report *Report, config *Config) error {
+	comments, err := listOwnIssueComments(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+	existing := make(map[string]*github.IssueComment)
+	for _, c := range comments {
+		if filename := fileCommentFilename(c.GetBody()); filename != "" {
+			existing[filename] = c
+		}
+	}
+
+	bodies := make(map[string]string)
+	var order []string
+	for _, result := range fileResults(report.Results) {
+		if len(result.Issues) == 0 {
+			continue
+		}
+		bodies[result.Filename] = renderFileComment(result, report.HeadSHA, config)
+		order = append(order, result.Filename)
+	}
+	for filename := range existing {
+		if _, ok := bodies[filename]; !ok && mayResolve(filename, report) {
+			bodies[filename] = renderResolvedFileComment(filename)
+		}
+	}
+
+	for _, filename := range order {
+		if err := upsertFileComment(ctx, client, owner, repo, prNumber, existing[filename], bodies[filename]); err != nil {
+			return fmt.Errorf("failed to post comment for %s: %w", filename, err)
+		}
+		delete(bodies, filename)
+	}
+	for filename, body := range bodies {
+		if err := upsertFileComment(ctx, client, owner, repo, prNumber, existing[filename], body); err != nil {
+			return fmt.Errorf("failed to update comment for %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// mayResolve reports whether this run knows a file has no issues left. It
+// doesn't for files the provider failed on or the budget skipped, or on an
+// interrupted run for files it didn't reach.
+func mayResolve(filename string, report *Report) bool {
+	if slices.Contains(report.Failed, filename) || slices.Contains(report.NotAnalyzed, filename) {
+		return false
+	}
+	if !report.Interrupted {
+		return true
+	}
+	for _, result := range report.Results {
+		if result.Filename == filename {
+			return true
+		}
+	}
+	return false
+}
+
+func upsertFileComment(ctx context.Context, client *github.Client, owner, repo string, prNumber int, previous *github.IssueComment, body string) error {
+	if previous == nil {
+		_, _, err := client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: &body})
+		return err
+	}
+	if previous.GetBody() == body {
+		return nil
+	}
+	_, _, err := client.Issues.EditComment(ctx, owner, repo, previous.GetID(), &github.IssueComment{Body: &body})
+	return err
+}
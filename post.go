@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// runPost publishes the results a pull_request run handed over as its
+// results artifact. Runs for pull requests from forks get a read-only
+// token, so a workflow_run job started by their completion, whose token
+// can write, posts the results for them. The artifact comes from the
+// fork's run and can't be trusted further than its findings, so it is only
+// accepted for the pull request whose head the run analyzed.
+func runPost(ctx context.Context, client *github.Client, owner, repo, configPath string) int {
+	path := os.Getenv("INPUT_RESULTS-ARTIFACT")
+	if path == "" {
+		fmt.Println("Error: mode post needs results-artifact, the path of the downloaded results.")
+		return 1
+	}
+	artifact, err := readResultsArtifact(path)
+	if err != nil {
+		fmt.Printf("Error reading results artifact: %v\n", err)
+		return 1
+	}
+	headSHA, err := workflowRunHead()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, artifact.PullRequest)
+	if err != nil {
+		fmt.Printf("Error getting pull request #%d: %v\n", artifact.PullRequest, err)
+		return 1
+	}
+	if pr.GetHead().GetSHA() != headSHA {
+		fmt.Printf("Error: the results are for pull request #%d, whose head %s is not the analyzed commit %s.\n", artifact.PullRequest, pr.GetHead().GetSHA(), headSHA)
+		return 1
+	}
+
+	// workflow_run runs on the default branch, so the checkout is trusted
+	// for the config.
+	configPath = resolveConfigPath(configPath, readLocalFile)
+	configContent, err := readLocalFile(configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return 1
+	}
+	config, err := parseConfig(configPath, []byte(configContent))
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return 1
+	}
+	if pr.GetDraft() && config.drafts() != draftsAnalyze {
+		fmt.Println("Skipping: the pull request is a draft.")
+		return 0
+	}
+
+	changedFiles, _, err := getChangedFiles(ctx, client, owner, repo, artifact.PullRequest)
+	if err != nil {
+		fmt.Printf("Error getting changed files: %v\n", err)
+		return 1
+	}
+	previous, err := findSummaryComment(ctx, client, owner, repo, artifact.PullRequest)
+	if err != nil {
+		fmt.Printf("Error looking up previous results: %v\n", err)
+		return 1
+	}
+	report := artifact.report()
+	if config.Comment.Permalinks {
+		report.HeadSHA = headSHA
+	}
+	publisher := &Publisher{
+		Client:      client,
+		Owner:       owner,
+		Repo:        repo,
+		PRNumber:    artifact.PullRequest,
+		Config:      config,
+		Previous:    previous,
+		Patches:     make(map[string]string, len(changedFiles)),
+		ReportTo:    os.Getenv("INPUT_REPORT-TO"),
+		UploadSARIF: getBoolInput("UPLOAD-SARIF"),
+		DryRun:      getBoolInput("DRY-RUN"),
+	}
+	for _, file := range changedFiles {
+		publisher.Patches[file.Filename] = file.Patch
+	}
+	fmt.Printf("Posting the results of pull request #%d.\n", artifact.PullRequest)
+	if err := publisher.Publish(ctx, report); err != nil {
+		fmt.Printf("Error posting results: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// workflowRunHead returns the commit the pull_request run that started the
+// workflow_run event analyzed.
+func workflowRunHead() (string, error) {
+	if os.Getenv("GITHUB_EVENT_NAME") != "workflow_run" {
+		return "", fmt.Errorf("mode post runs on workflow_run events, not %s", os.Getenv("GITHUB_EVENT_NAME"))
+	}
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read event file: %w", err)
+	}
+	var payload struct {
+		WorkflowRun struct {
+			Event   string `json:"event"`
+			HeadSHA string `json:"head_sha"`
+		} `json:"workflow_run"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return "", fmt.Errorf("failed to unmarshal event payload: %w", err)
+	}
+	if payload.WorkflowRun.Event != "pull_request" {
+		return "", fmt.Errorf("the workflow run was started by %q, not pull_request", payload.WorkflowRun.Event)
+	}
+	return payload.WorkflowRun.HeadSHA, nil
+}
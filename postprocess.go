@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// runPostProcess pipes the results through the external command configured
+// as postProcessCommand. The command reads the results as JSON on stdin and
+// must write the (possibly modified) results in the same shape to stdout.
+// Its stderr is passed through to the log.
+func runPostProcess(ctx context.Context, command string, results []*FileAnalysisResult) ([]*FileAnalysisResult, error) {
+	input, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("post-process command %s failed: %w", command, err)
+	}
+
+	decoder := json.NewDecoder(&stdout)
+	decoder.DisallowUnknownFields()
+	var processed []*FileAnalysisResult
+	if err := decoder.Decode(&processed); err != nil {
+		return nil, fmt.Errorf("post-process command %s returned malformed results: %w", command, err)
+	}
+	if err := validateResults(processed); err != nil {
+		return nil, fmt.Errorf("post-process command %s returned invalid results: %w", command, err)
+	}
+	return processed, nil
+}
+
+// validateResults checks the fields every output relies on.
+func validateResults(results []*FileAnalysisResult) error {
+	for i, result := range results {
+		if result == nil || result.Filename == "" {
+			return fmt.Errorf("result %d has no filename", i)
+		}
+		for j, issue := range result.Issues {
+			if issue.Type == "" || issue.Message == "" {
+				return fmt.Errorf("issue %d of %s needs both a type and a message", j, result.Filename)
+			}
+		}
+	}
+	return nil
+}
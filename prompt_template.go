@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// expandTemplateVars resolves {{.Vars.name}} references in the prompt
+// template against ai.templateVars. It runs when the config is loaded, so a
+// reference to an undefined variable fails the run before any file is
+// analyzed. The {rules} and {code} placeholders are left for buildPrompt,
+// which keeps rules and patches from being interpreted as template syntax.
+func expandTemplateVars(ai AIConfig) (string, error) {
+	if !strings.Contains(ai.PromptTemplate, "{{") {
+		return ai.PromptTemplate, nil
+	}
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(ai.PromptTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	vars := ai.TemplateVars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, struct{ Vars map[string]string }{vars}); err != nil {
+		return "", fmt.Errorf("prompt template: %w", err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Publisher posts a finished report to every output enabled in the config.
+type Publisher struct {
+	Client *github.Client
+	Owner  string
+	Repo   string
+	// PRNumber is 0 for a commit range, which is reported on HeadSHA
+	// through publishCommit, with Ref naming the head branch.
+	PRNumber int
+	HeadSHA  string
+	Ref      string
+	Config   *Config
+	// Previous is the summary comment of an earlier run, if any.
+	Previous *github.IssueComment
+	// Patches maps filenames to their patch, for placing inline comments.
+	Patches map[string]string
+	// ReportTo is "pr" (default) to report on the pull request or "issue"
+	// to report to a tracking issue instead.
+	ReportTo string
+	// UploadSARIF also sends the results to code scanning.
+	UploadSARIF bool
+	// DryRun prints what would be posted instead of posting it.
+	DryRun bool
+}
+
+func (p *Publisher) Publish(ctx context.Context, report *Report) error {
+	config := p.Config
+
+	if p.PRNumber == 0 {
+		return p.publishCommit(ctx, report)
+	}
+	if p.DryRun {
+		return p.preview(report)
+	}
+
+	if p.ReportTo == "issue" {
+		if err := postTrackingIssue(ctx, p.Client, p.Owner, p.Repo, report, p.Patches, config); err != nil {
+			return fmt.Errorf("failed to post tracking issue: %w", err)
+		}
+		return nil
+	}
+
+	// Cleaning up earlier comments is secondary to posting this run's
+	// results, so failures there are only reported.
+	if config.Comment.ResolveFixed {
+		resolved, err := resolveFixedThreads(ctx, p.Client, p.Owner, p.Repo, p.PRNumber)
+		if err != nil {
+			fmt.Printf("::warning::Failed to resolve fixed review threads: %v\n", err)
+		} else if resolved > 0 {
+			fmt.Printf("Resolved %d review thread(s) on changed lines.\n", resolved)
+		}
+	}
+	if config.Comment.stale() != staleKeep {
+		headSHA, err := getPullRequestHead(ctx, p.Client, p.Owner, p.Repo, p.PRNumber)
+		if err == nil {
+			err = hideStaleComments(ctx, p.Client, p.Owner, p.Repo, p.PRNumber, headSHA, config)
+		}
+		if err != nil {
+			fmt.Printf("::warning::Failed to hide stale comments: %v\n", err)
+		}
+	}
+
+	// Also after comment.requestChanges or the inline modes were turned
+	// off, so an old review can't keep blocking the merge.
+	if err := dismissStaleReviews(ctx, p.Client, p.Owner, p.Repo, p.PRNumber); err != nil {
+		return err
+	}
+	if config.Comment.postsInline() {
+		var inline []*FileAnalysisResult
+		inline, report.Summary = splitInlineIssues(report.Results, p.Patches)
+		report.InlineCount = countIssues(inline)
+
+		// In inline-only mode the issues that can't be placed on a line
+		// become the review's own text instead of a separate comment.
+		reviewBody := ""
+		if config.Comment.Mode == commentModeInline && countIssues(report.Summary) > 0 {
+			reviewBody = renderComment(report, config)
+		}
+		// Files unchanged since the previous run still carry its review
+		// comments, unless comment.stale hid them.
+		if config.Comment.stale() == staleKeep {
+			inline = slices.DeleteFunc(inline, func(result *FileAnalysisResult) bool {
+				return slices.Contains(report.Reused, result.Filename)
+			})
+		}
+		if err := postInlineComments(ctx, p.Client, p.Owner, p.Repo, p.PRNumber, inline, p.Patches, reviewBody, reviewEvent(report.Results, config), config); err != nil {
+			return fmt.Errorf("failed to post inline comments: %w", err)
+		}
+	}
+	switch config.Comment.Mode {
+	case commentModeInline, commentModeNone:
+	case commentModePerFile:
+		if err := postFileComments(ctx, p.Client, p.Owner, p.Repo, p.PRNumber, report, config); err != nil {
+			return err
+		}
+	default:
+		if err := postResults(ctx, p.Client, p.Owner, p.Repo, p.PRNumber, report, config, p.Previous); err != nil {
+			return err
+		}
+	}
+
+	if config.Check.Enabled {
+		headSHA, err := getPullRequestHead(ctx, p.Client, p.Owner, p.Repo, p.PRNumber)
+		if err == nil {
+			err = createCheckRun(ctx, p.Client, p.Owner, p.Repo, p.PRNumber, headSHA, report, config)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create check run: %w", err)
+		}
+	}
+	if config.Labels.enabled() {
+		if err := applyLabels(ctx, p.Client, p.Owner, p.Repo, p.PRNumber, report, config); err != nil {
+			return err
+		}
+	}
+	if config.Status.Enabled {
+		headSHA, err := getPullRequestHead(ctx, p.Client, p.Owner, p.Repo, p.PRNumber)
+		if err == nil {
+			err = setCommitStatus(ctx, p.Client, p.Owner, p.Repo, headSHA, report, config)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set commit status: %w", err)
+		}
+	}
+	if p.UploadSARIF {
+		headSHA, err := getPullRequestHead(ctx, p.Client, p.Owner, p.Repo, p.PRNumber)
+		if err == nil {
+			err = uploadSARIF(ctx, p.Client, p.Owner, p.Repo, fmt.Sprintf("refs/pull/%d/head", p.PRNumber), headSHA, report, config)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to upload SARIF: %w", err)
+		}
+	}
+	return nil
+}
+
+// preview prints the summary comment a real run would post. When a previous
+// summary comment exists it prints a unified diff against it instead, so the
+// in-place update can be checked before it is enabled for real.
+func (p *Publisher) preview(report *Report) error {
+	body, err := renderSummaryComment(report, p.Config)
+	if err != nil {
+		return err
+	}
+
+	if p.Previous == nil {
+		fmt.Println("Dry run: no previous comment, a new comment would be posted:")
+		fmt.Println(body)
+		return nil
+	}
+
+	// The hidden state is a single opaque line; leave it out so the diff
+	// shows only what reviewers would see change.
+	visible := func(body string) string {
+		return hiddenDataPattern.ReplaceAllString(body, "<!-- semantic-lint:state ... -->")
+	}
+	diff := unifiedDiff("previous comment", "updated comment", visible(p.Previous.GetBody()), visible(body))
+	if diff == "" {
+		fmt.Println("Dry run: the previous comment would not change.")
+		return nil
+	}
+	fmt.Printf("Dry run: comment %d would be updated:\n%s", p.Previous.GetID(), diff)
+	return nil
+}
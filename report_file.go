@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// writeMarkdownReport writes the rendered results to path, for uploading as
+// an artifact or publishing elsewhere. It uses the same rendering as the
+// summary comment, minus the hidden state. An empty path writes nothing.
+func writeMarkdownReport(path string, report *Report, config *Config) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(renderComment(report, config)), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote Markdown report to %s.\n", path)
+	return nil
+}
+
+// maxJobSummarySize is GitHub's limit on the job summary of one step.
+const maxJobSummarySize = 1024 * 1024
+
+// writeJobSummary adds the rendered results to the job summary, so they are
+// visible on the workflow run even when no comment can be posted.
+func writeJobSummary(report *Report, config *Config) error {
+	return writeStepSummary(truncate(renderComment(report, config), maxJobSummarySize) + "\n")
+}
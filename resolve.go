@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const reviewThreadsQuery = `query($owner: String!, $repo: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $after) {
+        nodes {
+          id
+          isResolved
+          isOutdated
+          comments(first: 1) { nodes { body viewerDidAuthor } }
+        }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+const resolveThreadMutation = `mutation($id: ID!) { resolveReviewThread(input: {threadId: $id}) { thread { isResolved } } }`
+
+type reviewThreadsPage struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				Nodes []struct {
+					ID         string `json:"id"`
+					IsResolved bool   `json:"isResolved"`
+					IsOutdated bool   `json:"isOutdated"`
+					Comments   struct {
+						Nodes []struct {
+							Body            string `json:"body"`
+							ViewerDidAuthor bool   `json:"viewerDidAuthor"`
+						} `json:"nodes"`
+					} `json:"comments"`
+				} `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"reviewThreads"`
+		} `json:"pullRequest"`
+	} `json:"repository"`
+}
+
+// resolveFixedThreads resolves the open review threads started by the
+// linter's inline comments whose lines have since changed. GitHub marks
+// such threads outdated on its own; resolving them collapses them so only
+// current findings stay open. It returns how many threads were resolved.
+func resolveFixedThreads(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (int, error) {
+	resolved := 0
+	variables := map[string]any{"owner": owner, "repo": repo, "number": prNumber}
+	for {
+		var page reviewThreadsPage
+		if err := runGraphQL(ctx, client, reviewThreadsQuery, variables, &page); err != nil {
+			return resolved, fmt.Errorf("failed to list review threads: %w", err)
+		}
+		threads := page.Repository.PullRequest.ReviewThreads
+		for _, thread := range threads.Nodes {
+			if thread.IsResolved || !thread.IsOutdated || len(thread.Comments.Nodes) == 0 {
+				continue
+			}
+			if first := thread.Comments.Nodes[0]; !first.ViewerDidAuthor || !strings.HasPrefix(first.Body, inlineMarkerPrefix) {
+				continue
+			}
+			if err := runGraphQL(ctx, client, resolveThreadMutation, map[string]any{"id": thread.ID}, nil); err != nil {
+				return resolved, fmt.Errorf("failed to resolve review thread: %w", err)
+			}
+			resolved++
+		}
+		if !threads.PageInfo.HasNextPage {
+			return resolved, nil
+		}
+		variables["after"] = threads.PageInfo.EndCursor
+	}
+}
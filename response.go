@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// parseAnalysisResult reads the JSON result out of a model's text response.
+// Models sometimes wrap the JSON in a Markdown fence or prose despite being
+// asked not to, so when the text isn't pure JSON the outermost object is
+// extracted and the result is marked as a format violation.
+func parseAnalysisResult(text, providerName string) (*AnalysisResult, error) {
+	var result AnalysisResult
+	trimmed := strings.TrimSpace(text)
+	if err := json.Unmarshal([]byte(trimmed), &result); err == nil {
+		return &result, nil
+	}
+
+	start, end := strings.Index(trimmed, "{"), strings.LastIndex(trimmed, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object found in %s response", providerName)
+	}
+	if err := json.Unmarshal([]byte(trimmed[start:end+1]), &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal analysis result from %s response: %w", providerName, err)
+	}
+	result.FormatViolation = true
+	return &result, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ModelRoute sends files matching all of its conditions to Model, e.g.
+// small diffs to a cheap model and large or security-sensitive files to a
+// stronger one. Unset conditions match every file.
+type ModelRoute struct {
+	// MinChangedLines and MaxChangedLines bound the number of lines the
+	// file's patch adds or changes. Zero means no bound.
+	MinChangedLines int `json:"minChangedLines"`
+	MaxChangedLines int `json:"maxChangedLines"`
+	// Languages are categories as detected from the file extension.
+	Languages []string `json:"languages"`
+	// Paths are globs.
+	Paths []string `json:"paths"`
+	Model string   `json:"model"`
+}
+
+func (r ModelRoute) matches(filename, category string, changedLines int) bool {
+	if r.MinChangedLines > 0 && changedLines < r.MinChangedLines {
+		return false
+	}
+	if r.MaxChangedLines > 0 && changedLines > r.MaxChangedLines {
+		return false
+	}
+	if len(r.Languages) > 0 && !slices.Contains(r.Languages, category) {
+		return false
+	}
+	if len(r.Paths) > 0 {
+		if match, _ := matchAny(filename, r.Paths); !match {
+			return false
+		}
+	}
+	return true
+}
+
+// routeModel returns the model of the first matching route, or "".
+func routeModel(routes []ModelRoute, filename, category string, changedLines int) string {
+	for _, route := range routes {
+		if route.matches(filename, category, changedLines) {
+			return route.Model
+		}
+	}
+	return ""
+}
+
+// validateModelRoutes rejects routes without a model or with invalid globs.
+func validateModelRoutes(routes []ModelRoute) error {
+	for i, route := range routes {
+		if route.Model == "" {
+			return fmt.Errorf("route %d has no model", i)
+		}
+		for _, pattern := range route.Paths {
+			if !doublestar.ValidatePattern(pattern) {
+				return fmt.Errorf("route %d: invalid pattern %q", i, pattern)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// defaultRules is used when the rules file is missing or empty and the
+// config sets requireRules to false. It keeps to language-neutral rules so it
+// is a reasonable start for any repository.
+const defaultRules = `# Default Semantic Linting Rules
+
+## Naming
+- Names of variables, functions and types must describe what they hold or do
+- Boolean names should read as a condition (is/has/should/can)
+
+## Complexity
+- Functions should do one thing and stay short
+- Avoid deep nesting; prefer early returns
+
+## Error Handling
+- Do not swallow errors; handle or propagate them with context
+- Error messages must say what failed
+
+## Best Practices
+- Avoid magic numbers and duplicated logic
+- Avoid global mutable state
+- Comments must stay accurate for the code they describe
+`
+
+// A "## " section of the rules file can be scoped to some files by putting an
+// HTML comment on the line right after its heading:
+//
+//	## TypeScript
+//	<!-- applies-to: **/*.ts, **/*.tsx -->
+//
+// Scoped sections are only sent for files matching one of the globs.
+// Sections without the comment, and any text before the first section,
+// apply to every file.
+var appliesToPattern = regexp.MustCompile(`^\s*<!--\s*applies-to:\s*(.*?)\s*-->\s*$`)
+
+type rulesSection struct {
+	text     string
+	patterns []string
+}
+
+func splitRulesSections(rules string) []rulesSection {
+	var sections []rulesSection
+	var current rulesSection
+	var lines []string
+	flush := func() {
+		current.text = strings.Join(lines, "\n")
+		if strings.TrimSpace(current.text) != "" {
+			sections = append(sections, current)
+		}
+		current, lines = rulesSection{}, nil
+	}
+
+	all := strings.Split(rules, "\n")
+	for i := 0; i < len(all); i++ {
+		line := all[i]
+		if strings.HasPrefix(line, "## ") {
+			flush()
+			lines = append(lines, line)
+			if i+1 < len(all) {
+				if match := appliesToPattern.FindStringSubmatch(all[i+1]); match != nil {
+					for _, pattern := range strings.Split(match[1], ",") {
+						if pattern = strings.TrimSpace(pattern); pattern != "" {
+							current.patterns = append(current.patterns, pattern)
+						}
+					}
+					i++
+				}
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return sections
+}
+
+// validateRulesScopes reports malformed applies-to globs up front, so a typo
+// doesn't silently drop a section.
+func validateRulesScopes(rules string) error {
+	for _, section := range splitRulesSections(rules) {
+		for _, pattern := range section.patterns {
+			if !doublestar.ValidatePattern(pattern) {
+				return fmt.Errorf("invalid applies-to pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// selectRules returns the parts of the rules document that apply to the
+// given file.
+func selectRules(rules, filename string) string {
+	sections := splitRulesSections(rules)
+	selected := make([]string, 0, len(sections))
+	for _, section := range sections {
+		if len(section.patterns) > 0 {
+			// Patterns were validated when the rules were loaded.
+			if match, _ := matchAny(filename, section.patterns); !match {
+				continue
+			}
+		}
+		selected = append(selected, section.text)
+	}
+	return strings.Join(selected, "\n")
+}
+
+// rulesPathFor returns the rules file mapped to a file's path, or "" when no
+// pattern matches.
+func rulesPathFor(rulesMap map[string]string, filename string) string {
+	return mostSpecificMatch(rulesMap, filename)
+}
+
+// mostSpecificMatch returns the value of the glob in m that matches
+// filename, or "" when none does. When several patterns match, the longest
+// (most specific) one wins, with ties broken alphabetically so the choice is
+// stable.
+func mostSpecificMatch(m map[string]string, filename string) string {
+	patterns := make([]string, 0, len(m))
+	for pattern := range m {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for _, pattern := range patterns {
+		// Patterns are validated when the config is loaded.
+		if match, _ := doublestar.Match(pattern, filename); match {
+			return m[pattern]
+		}
+	}
+	return ""
+}
+
+// loadMappedRules reads every rules file named in rulesMap.
+func loadMappedRules(rulesMap map[string]string, readFile fileReader) (map[string]string, error) {
+	mapped := make(map[string]string, len(rulesMap))
+	if err := validatePatterns(rulesMap); err != nil {
+		return nil, fmt.Errorf("rulesMap: %w", err)
+	}
+	for _, path := range rulesMap {
+		if _, ok := mapped[path]; ok {
+			continue
+		}
+		rules, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateRulesScopes(rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		mapped[path] = rules
+	}
+	return mapped, nil
+}
+
+// validatePatterns checks the glob keys of a path mapping.
+func validatePatterns(m map[string]string) error {
+	for pattern := range m {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const (
+	sarifVersion  = "2.1.0"
+	sarifSchema   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName = "semantic-linter"
+)
+
+// The SARIF types cover only the parts of the 2.1.0 format the linter
+// fills in.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// buildSARIF converts the results to a SARIF log with one rule per issue
+// type. Issues without a line are placed on the first line, since code
+// scanning requires a region.
+func buildSARIF(report *Report, config *Config) *sarifLog {
+	ruleIDs := make(map[string]bool)
+	results := make([]sarifResult, 0)
+	for _, result := range fileResults(report.Results) {
+		for _, issue := range result.Issues {
+			ruleIDs[issue.Type] = true
+
+			level := "warning"
+			if issueSeverity(issue, config) == "error" {
+				level = "error"
+			}
+			text := issue.Message
+			if issue.Suggestion != "" {
+				text += "\n\nSuggestion: " + issue.Suggestion
+			}
+			region := sarifRegion{StartLine: max(issue.Line, 1)}
+			if issue.EndLine > region.StartLine {
+				region.EndLine = issue.EndLine
+			}
+			results = append(results, sarifResult{
+				RuleID:  issue.Type,
+				Level:   level,
+				Message: sarifMessage{Text: text},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: result.Filename},
+					Region:           region,
+				}}},
+			})
+		}
+	}
+
+	rules := make([]sarifRule, 0, len(ruleIDs))
+	for id := range ruleIDs {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: "Semantic linting rule: " + id}})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	return &sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: sarifToolName, Rules: rules}},
+			Results: results,
+		}},
+	}
+}
+
+// writeSARIFReport writes the results as SARIF to path. An empty path
+// writes nothing.
+func writeSARIFReport(path string, report *Report, config *Config) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(buildSARIF(report, config), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote SARIF report to %s.\n", path)
+	return nil
+}
+
+// uploadSARIF sends the results to code scanning for headSHA on ref, e.g.
+// refs/pull/1/head, so they show as code scanning alerts.
+func uploadSARIF(ctx context.Context, client *github.Client, owner, repo, ref, headSHA string, report *Report, config *Config) error {
+	data, err := json.Marshal(buildSARIF(report, config))
+	if err != nil {
+		return err
+	}
+
+	// The API takes the SARIF file gzipped and base64 encoded.
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	analysis := &github.SarifAnalysis{
+		CommitSHA: github.String(headSHA),
+		Ref:       github.String(ref),
+		Sarif:     github.String(base64.StdEncoding.EncodeToString(compressed.Bytes())),
+		ToolName:  github.String(sarifToolName),
+	}
+	_, _, err = client.CodeScanning.UploadSarif(ctx, owner, repo, analysis)
+	// GitHub processes uploads asynchronously and answers 202 Accepted.
+	var accepted *github.AcceptedError
+	if errors.As(err, &accepted) {
+		err = nil
+	}
+	return err
+}
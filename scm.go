@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ReviewHost is a code host whose merge requests are analyzed outside of a
+// GitHub Actions run, such as GitLab from GitLab CI, Bitbucket Cloud from
+// Bitbucket Pipelines, or GitHub itself from another CI system. The
+// Action's flow in main publishes through Publisher instead, since most of
+// its outputs (checks, statuses, labels, code scanning) have no
+// counterpart elsewhere.
+type ReviewHost interface {
+	// ChangedFiles returns the changes of the merge request, with patches
+	// in the unified diff form the GitHub API returns.
+	ChangedFiles(ctx context.Context) ([]*ChangedFile, error)
+	// AddedLines returns, per file, the new-file lines a line comment can
+	// be placed on.
+	AddedLines(files []*ChangedFile) map[string]map[int]bool
+	// PostLineComment comments on the line of the new version of a file
+	// the issue is about. Hosts skip a comment identical to one already on
+	// that line, so a re-run doesn't repeat itself.
+	PostLineComment(ctx context.Context, comment LineComment) error
+	// PostSummary posts the summary comment, or updates the one an earlier
+	// run posted. Hosts that track the status of comments mark it resolved
+	// when the run is clean. It is called last, with an empty body when no
+	// summary is wanted, so hosts that batch line comments post them here.
+	PostSummary(ctx context.Context, body string, clean bool) error
+}
+
+// SummaryReader is implemented by hosts whose summary comment keeps the
+// hidden state of the results, so a re-run reuses the results of files
+// that haven't changed since.
+type SummaryReader interface {
+	// PreviousSummary returns the body of the summary comment an earlier
+	// run posted, or "" when there is none.
+	PreviousSummary(ctx context.Context) (string, error)
+}
+
+// LineComment is an issue placed on a line of a file's new version.
+type LineComment struct {
+	Filename string
+	Issue    Issue
+	// Severity is the issue's effective severity, for hosts that record
+	// it.
+	Severity string
+	// Body is the issue rendered as a Markdown comment.
+	Body string
+}
+
+// runReview analyzes the changes of a merge request on host and reports the
+// results as its comment.mode asks for: line comments, a summary comment or
+// both. Like the Action, it reuses the results of unchanged files where the
+// host keeps them, and applies the heuristics, the post-process command,
+// scoring and the token budget. It returns the process exit code, 1 when
+// any issue has error severity or a file could not be analyzed.
+func runReview(ctx context.Context, host ReviewHost, analyzer *Analyzer, configPath string) int {
+	config := analyzer.Config
+	changedFiles, err := host.ChangedFiles(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting changed files: %v\n", err)
+		return 1
+	}
+	for _, file := range changedFiles {
+		// Hosts that don't report blob SHAs identify a file version by
+		// its patch, for reuse.
+		if file.SHA == "" {
+			file.SHA = contentHash(file.Patch)
+		}
+	}
+	files, err := filterFiles(changedFiles, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering files: %v\n", err)
+		return 1
+	}
+	files = filterSmallPatches(files, config.Limits)
+	if config.PackageConfigs {
+		analyzer.Packages, err = discoverPackageConfigs(files, configPath, readLocalFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading package configs: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Printf("Found %d files to analyze.\n", len(files))
+
+	var reused []*FileAnalysisResult
+	if summaries, ok := host.(SummaryReader); ok {
+		previous, err := summaries.PreviousSummary(ctx)
+		if err == nil {
+			files, reused, err = reusePreviousResults(previous, files)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ignoring unreadable previous results: %v\n", err)
+		}
+		if len(reused) > 0 {
+			fmt.Printf("Reusing previous results for %d file(s), analyzing %d.\n", len(reused), len(files))
+		}
+	}
+
+	report := analyzer.AnalyzeFiles(ctx, files)
+
+	// The context may be cancelled by now, so the partial results are
+	// post-processed and posted on a context of their own.
+	ctx, cancel := afterCancelGrace(ctx)
+	defer cancel()
+	if err := completeReport(ctx, report, config, changedFiles, reused); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if config.Scoring.Enabled {
+		score := computeScore(report.Results, config)
+		report.Score = &score
+		fmt.Printf("Score: %d/100\n", score)
+	}
+	printTerminalReport(report, config)
+
+	if config.Comment.postsInline() {
+		// Reused results are placed too; hosts skip the comments that are
+		// still there.
+		added := host.AddedLines(changedFiles)
+		var rest []*FileAnalysisResult
+		for _, result := range report.Results {
+			unplaced := &FileAnalysisResult{Filename: result.Filename, SHA: result.SHA}
+			for _, issue := range result.Issues {
+				if issue.Line <= 0 || !added[result.Filename][issue.Line] {
+					unplaced.Issues = append(unplaced.Issues, issue)
+					continue
+				}
+				// Suggestions replace a single line on every host, so
+				// longer suggested code is shown as a plain block.
+				suggest := issue.EndLine <= issue.Line && suggestionFits(issue, added[result.Filename])
+				comment := LineComment{
+					Filename: result.Filename,
+					Issue:    issue,
+					Severity: issueSeverity(issue, config),
+					Body:     renderInlineIssue(issue, result.Filename, suggest, config),
+				}
+				if err := host.PostLineComment(ctx, comment); err != nil {
+					fmt.Fprintf(os.Stderr, "Error posting line comment: %v\n", err)
+					return 1
+				}
+				report.InlineCount++
+			}
+			rest = append(rest, unplaced)
+		}
+		report.Summary = rest
+	}
+
+	var postSummary bool
+	switch config.Comment.Mode {
+	case commentModeNone:
+	case commentModeInline:
+		postSummary = countIssues(report.Summary) > 0
+	default:
+		postSummary = !report.clean() || config.Comment.WhenClean != whenCleanSilent
+	}
+	body := ""
+	if postSummary {
+		body, err = renderSummaryComment(report, config)
+	}
+	if err == nil {
+		err = host.PostSummary(ctx, body, report.clean())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting summary comment: %v\n", err)
+		return 1
+	}
+
+	if hasErrors(report.Results, config) || len(report.Failed) > 0 || report.Interrupted {
+		return 1
+	}
+	return 0
+}
+
+// hostRequest sends a request with a JSON body, unless body is nil, to a
+// host's REST API, with authorize adding the credentials. It returns the
+// response body and headers; a status outside 2xx is an error.
+func hostRequest(ctx context.Context, client *http.Client, method, url string, body any, authorize func(*http.Request)) ([]byte, http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	authorize(req)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, strings.TrimSpace(truncate(string(data), 1024)))
+	}
+	return data, resp.Header, nil
+}
+
+// summaryHeading starts the summary comment. Hosts that show HTML as text
+// get comments without the hidden markers and state, and find the summary
+// by its heading instead.
+const summaryHeading = "## Semantic Linting Results"
+
+var htmlCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->\n?`)
+
+// stripHiddenData removes the HTML comments that carry the hidden markers
+// and state of a rendered comment.
+func stripHiddenData(body string) string {
+	return htmlCommentPattern.ReplaceAllString(body, "")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// ScoringConfig turns the issue set into a single 0-100 quality score:
+//
+//	score = max(0, 100 - sum of the weight of every issue)
+//
+// An issue's weight is its type's entry in TypeWeights if there is one, and
+// otherwise its severity's entry in SeverityWeights. The result is rounded
+// to the nearest integer, so the same issues always give the same score.
+type ScoringConfig struct {
+	Enabled         bool               `json:"enabled"`
+	SeverityWeights map[string]float64 `json:"severityWeights"`
+	TypeWeights     map[string]float64 `json:"typeWeights"`
+}
+
+var defaultSeverityWeights = map[string]float64{
+	"error":   10,
+	"warning": 2,
+}
+
+func computeScore(results []*FileAnalysisResult, config *Config) int {
+	penalty := 0.0
+	for _, result := range results {
+		for _, issue := range result.Issues {
+			penalty += issueWeight(issue, config)
+		}
+	}
+	return int(math.Round(math.Max(0, 100-penalty)))
+}
+
+func issueWeight(issue Issue, config *Config) float64 {
+	if weight, ok := config.Scoring.TypeWeights[issue.Type]; ok {
+		return weight
+	}
+	severity := issueSeverity(issue, config)
+	if weight, ok := config.Scoring.SeverityWeights[severity]; ok {
+		return weight
+	}
+	return defaultSeverityWeights[severity]
+}
+
+// setOutput sets a step output for later steps of the workflow. It is a
+// no-op outside of GitHub Actions.
+func setOutput(name, value string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s=%s\n", name, value)
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// shardInputs reads the shard-index and shard-total inputs. A total of 0
+// means the run isn't sharded.
+func shardInputs() (index, total int, err error) {
+	if os.Getenv("INPUT_SHARD-TOTAL") == "" {
+		return 0, 0, nil
+	}
+	total, err = strconv.Atoi(os.Getenv("INPUT_SHARD-TOTAL"))
+	if err != nil || total < 1 {
+		return 0, 0, fmt.Errorf("shard-total must be a positive number, got %q", os.Getenv("INPUT_SHARD-TOTAL"))
+	}
+	index, err = strconv.Atoi(os.Getenv("INPUT_SHARD-INDEX"))
+	if err != nil || index < 0 || index >= total {
+		return 0, 0, fmt.Errorf("shard-index must be between 0 and %d, got %q", total-1, os.Getenv("INPUT_SHARD-INDEX"))
+	}
+	return index, total, nil
+}
+
+// shardFiles returns the files shard index of total analyzes. Files are
+// dealt out largest patch first, each to the shard with the least patch
+// bytes so far, so shards get similar amounts of work. Every shard sees
+// the same file list and makes the same choices, so the shards together
+// cover each file exactly once. The files keep their order.
+func shardFiles(files []*ChangedFile, index, total int) []*ChangedFile {
+	order := make([]*ChangedFile, len(files))
+	copy(order, files)
+	sort.SliceStable(order, func(i, j int) bool {
+		if len(order[i].Patch) != len(order[j].Patch) {
+			return len(order[i].Patch) > len(order[j].Patch)
+		}
+		return order[i].Filename < order[j].Filename
+	})
+
+	loads := make([]int, total)
+	mine := make(map[*ChangedFile]bool)
+	for _, file := range order {
+		target := 0
+		for i, load := range loads {
+			if load < loads[target] {
+				target = i
+			}
+		}
+		loads[target] += len(file.Patch)
+		if target == index {
+			mine[file] = true
+		}
+	}
+
+	var shard []*ChangedFile
+	for _, file := range files {
+		if mine[file] {
+			shard = append(shard, file)
+		}
+	}
+	return shard
+}
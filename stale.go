@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Stale comment handling, set by comment.stale. Comments from earlier runs
+// are "stale" once newer results are posted: the linter's inline comments
+// on an older commit, and with comment.update "append" its earlier summary
+// comments.
+const (
+	staleKeep     = "keep"
+	staleMinimize = "minimize"
+	staleDelete   = "delete"
+)
+
+func (c CommentConfig) stale() string {
+	if c.Stale == "" {
+		return staleKeep
+	}
+	return c.Stale
+}
+
+// hideStaleComments minimizes as outdated, or deletes, the linter's comments
+// from earlier runs. It runs before the new results are posted. Comments
+// other people wrote are left alone even when they carry a marker.
+func hideStaleComments(ctx context.Context, client *github.Client, owner, repo string, prNumber int, headSHA string, config *Config) error {
+	mode := config.Comment.stale()
+	if mode == staleKeep {
+		return nil
+	}
+
+	if config.Comment.update() == commentUpdateAppend {
+		comments, err := listOwnIssueComments(ctx, client, owner, repo, prNumber)
+		if err != nil {
+			return fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if !strings.HasPrefix(c.GetBody(), summaryMarker) && !strings.HasPrefix(c.GetBody(), continuationMarkerPrefix) {
+				continue
+			}
+			if mode == staleDelete {
+				_, err = client.Issues.DeleteComment(ctx, owner, repo, c.GetID())
+			} else {
+				err = minimizeComment(ctx, client, c.GetNodeID())
+			}
+			if err != nil {
+				return fmt.Errorf("failed to hide comment %d: %w", c.GetID(), err)
+			}
+		}
+	}
+
+	login, err := tokenLogin(ctx, client)
+	if err != nil {
+		return err
+	}
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list review comments: %w", err)
+		}
+		for _, c := range comments {
+			if !strings.HasPrefix(c.GetBody(), inlineMarkerPrefix) || !writtenBy(c.GetUser(), login) || c.GetOriginalCommitID() == headSHA {
+				continue
+			}
+			if mode == staleDelete {
+				_, err = client.PullRequests.DeleteComment(ctx, owner, repo, c.GetID())
+			} else {
+				err = minimizeComment(ctx, client, c.GetNodeID())
+			}
+			if err != nil {
+				return fmt.Errorf("failed to hide review comment %d: %w", c.GetID(), err)
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// minimizeComment collapses a comment as outdated. Only the GraphQL API
+// can minimize comments.
+func minimizeComment(ctx context.Context, client *github.Client, nodeID string) error {
+	const mutation = `mutation($id: ID!) { minimizeComment(input: {subjectId: $id, classifier: OUTDATED}) { minimizedComment { isMinimized } } }`
+	return runGraphQL(ctx, client, mutation, map[string]any{"id": nodeID}, nil)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// The summary comment carries a hidden marker so later runs can find it, and
+// a hidden copy of the per-file results so a re-run can skip files that were
+// already analyzed successfully at the same blob SHA.
+const summaryMarker = "<!-- semantic-lint:summary -->"
+
+var hiddenDataPattern = regexp.MustCompile(`<!-- semantic-lint:(\w+) ([A-Za-z0-9+/=]+) -->`)
+
+// encodeHiddenData embeds v in an HTML comment. The JSON is base64 encoded
+// so it can never terminate the comment early.
+func encodeHiddenData(kind string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s data: %w", kind, err)
+	}
+	return fmt.Sprintf("<!-- semantic-lint:%s %s -->", kind, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// decodeHiddenData reads back data written by encodeHiddenData. It reports
+// false if the body holds no data of the given kind.
+func decodeHiddenData(body, kind string, v any) (bool, error) {
+	for _, match := range hiddenDataPattern.FindAllStringSubmatch(body, -1) {
+		if match[1] != kind {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(match[2])
+		if err != nil {
+			return true, fmt.Errorf("failed to decode %s data: %w", kind, err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return true, fmt.Errorf("failed to unmarshal %s data: %w", kind, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// findSummaryComment returns the summary comment posted by the latest
+// previous run, or nil if there is none. There is more than one when
+// comment.update is "append". Only comments written with the same token
+// count, so no one else can plant results for the run to reuse.
+func findSummaryComment(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (*github.IssueComment, error) {
+	comments, err := listOwnIssueComments(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	var latest *github.IssueComment
+	for _, c := range comments {
+		if strings.HasPrefix(c.GetBody(), summaryMarker) {
+			latest = c
+		}
+	}
+	return latest, nil
+}
+
+// reusePreviousResults splits files into those that still need analysis and
+// the results of those a previous run already analyzed at the same SHA,
+// which are stored in the body of its summary comment.
+func reusePreviousResults(previous string, files []*ChangedFile) ([]*ChangedFile, []*FileAnalysisResult, error) {
+	var prior []*FileAnalysisResult
+	found, err := decodeHiddenData(previous, "state", &prior)
+	if err != nil || !found {
+		return files, nil, err
+	}
+
+	bySHA := make(map[string]*FileAnalysisResult, len(prior))
+	for _, result := range prior {
+		if result.SHA != "" {
+			bySHA[result.Filename+"@"+result.SHA] = result
+		}
+	}
+
+	var pending []*ChangedFile
+	var reused []*FileAnalysisResult
+	for _, file := range files {
+		if result, ok := bySHA[file.Filename+"@"+file.SHA]; ok && file.SHA != "" {
+			reused = append(reused, result)
+			continue
+		}
+		pending = append(pending, file)
+	}
+	return pending, reused, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// StatusConfig controls the commit status set on the pull request head, for
+// branch protection that gates on classic status checks.
+type StatusConfig struct {
+	Enabled bool `json:"enabled"`
+	// Context names the status. Defaults to "semantic-lint".
+	Context string `json:"context"`
+}
+
+const (
+	defaultStatusContext = "semantic-lint"
+	// maxStatusDescriptionLength is GitHub's limit on a status description.
+	maxStatusDescriptionLength = 140
+)
+
+// setCommitStatus reports the run as a commit status: error when the run
+// didn't analyze every file, failure when there are errors, the same as the
+// action's exit code, and success otherwise.
+func setCommitStatus(ctx context.Context, client *github.Client, owner, repo, headSHA string, report *Report, config *Config) error {
+	name := config.Status.Context
+	if name == "" {
+		name = defaultStatusContext
+	}
+
+	errors, warnings := countSeverities(report.Results, config)
+	description := fmt.Sprintf("%d error(s), %d warning(s)", errors, warnings)
+	if report.Score != nil {
+		description = fmt.Sprintf("Score %d/100: %s", *report.Score, description)
+	}
+
+	state := "success"
+	switch {
+	case !report.complete():
+		state = "error"
+		description = incompleteReason(report) + " " + description
+	case errors > 0:
+		state = "failure"
+	}
+
+	status := &github.RepoStatus{
+		State:       github.String(state),
+		Context:     github.String(name),
+		Description: github.String(truncate(description, maxStatusDescriptionLength)),
+	}
+	if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+		status.TargetURL = github.String(fmt.Sprintf("%s/%s/%s/actions/runs/%s", serverURL(), owner, repo, runID))
+	}
+	_, _, err := client.Repositories.CreateStatus(ctx, owner, repo, headSHA, status)
+	return err
+}
+
+// incompleteReason says why the run didn't analyze every file, or is empty
+// when it did.
+func incompleteReason(report *Report) string {
+	switch {
+	case report.Interrupted:
+		return "Interrupted before all files were analyzed."
+	case report.BudgetReached:
+		return "Token budget reached before all files were analyzed."
+	case len(report.Failed) > 0:
+		return fmt.Sprintf("%d file(s) could not be analyzed.", len(report.Failed))
+	}
+	return ""
+}
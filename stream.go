@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// maxStreamEventSize bounds one server-sent event, which holds at most a
+// chunk of the model's response.
+const maxStreamEventSize = 1 << 20
+
+// readSSE calls handle with the data of each server-sent event until the
+// stream ends or sends the OpenAI "[DONE]" sentinel.
+func readSSE(r io.Reader, handle func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamEventSize)
+
+	var data bytes.Buffer
+	dispatch := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+		defer data.Reset()
+		return handle(data.Bytes())
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			// Event names, ids and comments carry nothing the decoders
+			// need; the data says what kind of event it is.
+			continue
+		}
+		value = strings.TrimPrefix(value, " ")
+		if value == "[DONE]" {
+			return nil
+		}
+		if data.Len() > 0 {
+			data.WriteByte('\n')
+		}
+		data.WriteString(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// geminiStreamEndpoint turns a generateContent endpoint into its streaming
+// counterpart.
+func geminiStreamEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(strings.Replace(endpoint, ":generateContent", ":streamGenerateContent", 1))
+	if err != nil {
+		return "", fmt.Errorf("invalid gemini endpoint: %w", err)
+	}
+	query := u.Query()
+	query.Set("alt", "sse")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// decodeGeminiStream merges the chunks of a streamed Gemini response into
+// one response, joining the text of consecutive parts.
+func decodeGeminiStream(r io.Reader) (*GeminiResponse, error) {
+	var merged GeminiResponse
+	err := readSSE(r, func(data []byte) error {
+		var chunk GeminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return err
+		}
+		if chunk.PromptFeedback.BlockReason != "" {
+			merged.PromptFeedback = chunk.PromptFeedback
+		}
+		if chunk.UsageMetadata.PromptTokenCount > 0 {
+			// Each chunk reports the usage so far.
+			merged.UsageMetadata = chunk.UsageMetadata
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		if len(merged.Candidates) == 0 {
+			merged.Candidates = chunk.Candidates[:1]
+			return nil
+		}
+		candidate := &merged.Candidates[0]
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			parts := candidate.Content.Parts
+			if part.FunctionCall == nil && len(parts) > 0 && parts[len(parts)-1].FunctionCall == nil {
+				parts[len(parts)-1].Text += part.Text
+				continue
+			}
+			candidate.Content.Parts = append(parts, part)
+		}
+		if reason := chunk.Candidates[0].FinishReason; reason != "" {
+			candidate.FinishReason = reason
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// decodeOpenAIStream merges the deltas of a streamed chat completion into
+// the message of one choice.
+func decodeOpenAIStream(r io.Reader) (*OpenAIResponse, error) {
+	var merged OpenAIResponse
+	err := readSSE(r, func(data []byte) error {
+		var chunk OpenAIResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return err
+		}
+		if chunk.Usage != nil {
+			// Sent in a final chunk without choices, as requested by
+			// stream_options.
+			merged.Usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		delta := chunk.Choices[0].Delta
+		if len(merged.Choices) == 0 {
+			merged.Choices = chunk.Choices[:1]
+			merged.Choices[0].Delta = OpenAIResponseMessage{}
+		}
+		choice := &merged.Choices[0]
+		choice.Message.Content += delta.Content
+		for _, call := range delta.ToolCalls {
+			for len(choice.Message.ToolCalls) <= call.Index {
+				choice.Message.ToolCalls = append(choice.Message.ToolCalls, OpenAIToolCall{Index: len(choice.Message.ToolCalls)})
+			}
+			toolCall := &choice.Message.ToolCalls[call.Index]
+			toolCall.Function.Name += call.Function.Name
+			toolCall.Function.Arguments += call.Function.Arguments
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			choice.FinishReason = reason
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// anthropicStreamEvent is one event of a streamed Messages response. Which
+// fields are set depends on Type.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock AnthropicContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	// Usage is the output token count so far, sent with message_delta.
+	Usage AnthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// decodeAnthropicStream rebuilds the content blocks of a streamed Messages
+// response from its events.
+func decodeAnthropicStream(r io.Reader) (*AnthropicResponse, error) {
+	var merged AnthropicResponse
+	err := readSSE(r, func(data []byte) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		switch event.Type {
+		case "message_start":
+			merged.Usage = event.Message.Usage
+		case "content_block_start":
+			block := event.ContentBlock
+			if block.Type == "tool_use" {
+				// The input arrives as JSON fragments in later deltas.
+				block.Input = nil
+			}
+			merged.Content = append(merged.Content, block)
+		case "content_block_delta":
+			if event.Index >= len(merged.Content) {
+				return fmt.Errorf("delta for unknown content block %d", event.Index)
+			}
+			block := &merged.Content[event.Index]
+			block.Text += event.Delta.Text
+			block.Input = append(block.Input, event.Delta.PartialJSON...)
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				merged.StopReason = event.Delta.StopReason
+			}
+			if event.Usage.OutputTokens > 0 {
+				merged.Usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			return fmt.Errorf("anthropic stream error %s: %s", event.Error.Type, event.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range merged.Content {
+		if merged.Content[i].Type == "tool_use" && len(merged.Content[i].Input) == 0 {
+			merged.Content[i].Input = json.RawMessage("{}")
+		}
+	}
+	return &merged, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The config and rules are read from these paths unless the config-path
+// and rules-path inputs, or the -config and -rules flags, say otherwise.
+const (
+	defaultConfigPath = ".github/semantic-lint.config.json"
+	defaultRulesPath  = ".github/SemanticLintingRules.md"
+)
+
+// defaultYAMLConfigPaths are read in order when there is no config at
+// defaultConfigPath.
+var defaultYAMLConfigPaths = []string{
+	".github/semantic-lint.config.yaml",
+	".github/semantic-lint.config.yml",
+}
+
+// resolveConfigPath returns configPath, or, when it is the default and
+// readFile can't read it, the first YAML default readFile can.
+func resolveConfigPath(configPath string, readFile fileReader) string {
+	if configPath != defaultConfigPath {
+		return configPath
+	}
+	if _, err := readFile(configPath); err == nil {
+		return configPath
+	}
+	for _, path := range defaultYAMLConfigPaths {
+		if _, err := readFile(path); err == nil {
+			return path
+		}
+	}
+	return configPath
+}
+
+// subcommand is a mode of the binary run from the command line, such as
+// local or gitlab, with its flags. Every subcommand reads the config and
+// rules from the working tree, at the paths -config and -rules give.
+type subcommand struct {
+	*flag.FlagSet
+	configPath *string
+	rulesPath  *string
+}
+
+func newSubcommand(name string) *subcommand {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &subcommand{
+		FlagSet:    flags,
+		configPath: flags.String("config", defaultConfigPath, "config file"),
+		rulesPath:  flags.String("rules", defaultRulesPath, "rules file"),
+	}
+}
+
+// run parses args, resolves the config path and calls run with a context
+// that is canceled on SIGINT or SIGTERM. It returns the exit code run returns, or 2 when args are
+// invalid.
+func (c *subcommand) run(args []string, run func(ctx context.Context) int) int {
+	if err := c.Parse(args); err != nil {
+		return 2
+	}
+	*c.configPath = resolveConfigPath(*c.configPath, readLocalFile)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return run(ctx)
+}
+
+// review runs a code host subcommand: it analyzes the review newHost
+// returns, which is called once the flags are parsed, and reports on it
+// with runReview.
+func (c *subcommand) review(args []string, newHost func() (ReviewHost, error)) int {
+	return c.run(args, func(ctx context.Context) int {
+		host, err := newHost()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		analyzer, err := newLocalAnalyzer(*c.configPath, *c.rulesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return runReview(ctx, host, analyzer, *c.configPath)
+	})
+}
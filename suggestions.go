@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// applySuggestion replaces lines start..end (1-based, inclusive) of content
+// with the suggested code.
+func applySuggestion(content string, start, end int, code string) (string, error) {
+	lines := strings.Split(content, "\n")
+	if end < start {
+		end = start
+	}
+	if start < 1 || end > len(lines) {
+		return "", fmt.Errorf("lines %d-%d are outside the file", start, end)
+	}
+	replaced := append([]string{}, lines[:start-1]...)
+	replaced = append(replaced, strings.Split(code, "\n")...)
+	replaced = append(replaced, lines[end:]...)
+	return strings.Join(replaced, "\n"), nil
+}
+
+// validateSuggestions drops suggested code that would leave a Go file
+// unparseable. Each Go file with suggestions is fetched once and every
+// suggestion is checked on its own against the original content. It
+// returns how many suggestions were dropped.
+func validateSuggestions(ctx context.Context, results []*FileAnalysisResult, fetchFile func(ctx context.Context, path string) (string, error)) int {
+	dropped := 0
+	for _, result := range results {
+		if filepath.Ext(result.Filename) != ".go" {
+			continue
+		}
+		content, fetched := "", false
+		for i := range result.Issues {
+			issue := &result.Issues[i]
+			if issue.SuggestedCode == "" {
+				continue
+			}
+			if !fetched {
+				var err error
+				content, err = fetchFile(ctx, result.Filename)
+				if err != nil {
+					fmt.Printf("Could not fetch %s to validate suggestions: %v\n", result.Filename, err)
+					break
+				}
+				fetched = true
+			}
+
+			applied, err := applySuggestion(content, issue.Line, issue.EndLine, issue.SuggestedCode)
+			if err == nil {
+				_, err = parser.ParseFile(token.NewFileSet(), result.Filename, applied, parser.AllErrors)
+			}
+			if err != nil {
+				fmt.Printf("Dropping invalid suggestion for %s:%d: %v\n", result.Filename, issue.Line, err)
+				issue.SuggestedCode = ""
+				dropped++
+			}
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unifiedDiff returns a unified diff of two texts with three lines of
+// context, or "" if they are equal. It uses a plain LCS table, which is fine
+// for comment-sized inputs.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type op struct {
+		kind       byte
+		text       string
+		oldN, newN int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// Grow the hunk until more than 2*context unchanged lines follow.
+		from := max(0, start-context)
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k
+			} else if k-end > 2*context {
+				break
+			}
+		}
+		to := min(len(ops), end+context+1)
+
+		oldCount, newCount := 0, 0
+		for _, o := range ops[from:to] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", ops[from].oldN+1, oldCount, ops[from].newN+1, newCount))
+		for _, o := range ops[from:to] {
+			out.WriteString(string(o.kind) + o.text + "\n")
+		}
+		start = to
+	}
+	return out.String()
+}
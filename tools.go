@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// With toolCalling enabled, providers that support it are forced to call a
+// report_issues tool whose arguments are the AnalysisResult, so the result
+// arrives as structured arguments validated by the provider instead of
+// free-form text.
+const (
+	reportIssuesTool        = "report_issues"
+	reportIssuesDescription = "Report the issues found in the code changes."
+)
+
+// reportIssuesSchema is the JSON Schema of the tool's arguments.
+var reportIssuesSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"issues": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"type":          map[string]any{"type": "string"},
+					"message":       map[string]any{"type": "string"},
+					"suggestion":    map[string]any{"type": "string"},
+					"line":          map[string]any{"type": "integer"},
+					"endLine":       map[string]any{"type": "integer"},
+					"suggestedCode": map[string]any{"type": "string"},
+				},
+				"required": []string{"type", "message"},
+			},
+		},
+		"needContext": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":   map[string]any{"type": "string"},
+					"symbol": map[string]any{"type": "string"},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	"required": []string{"issues"},
+}
+
+type OpenAITool struct {
+	Type     string             `json:"type"`
+	Function OpenAIToolFunction `json:"function"`
+}
+
+type OpenAIToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type AnthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type GeminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames"`
+	} `json:"functionCallingConfig"`
+}
+
+func openAIReportIssuesTool() []OpenAITool {
+	return []OpenAITool{{
+		Type: "function",
+		Function: OpenAIToolFunction{
+			Name:        reportIssuesTool,
+			Description: reportIssuesDescription,
+			Parameters:  reportIssuesSchema,
+		},
+	}}
+}
+
+func anthropicReportIssuesTool() []AnthropicTool {
+	return []AnthropicTool{{Name: reportIssuesTool, Description: reportIssuesDescription, InputSchema: reportIssuesSchema}}
+}
+
+func geminiReportIssuesTool() ([]GeminiTool, *GeminiToolConfig) {
+	tools := []GeminiTool{{FunctionDeclarations: []GeminiFunctionDeclaration{{
+		Name:        reportIssuesTool,
+		Description: reportIssuesDescription,
+		Parameters:  geminiResponseSchema,
+	}}}}
+	config := &GeminiToolConfig{}
+	config.FunctionCallingConfig.Mode = "ANY"
+	config.FunctionCallingConfig.AllowedFunctionNames = []string{reportIssuesTool}
+	return tools, config
+}
+
+// parseToolArguments reads the result from report_issues arguments.
+func parseToolArguments(name string, args []byte, providerName string) (*AnalysisResult, error) {
+	if name != reportIssuesTool {
+		return nil, fmt.Errorf("%s called unexpected tool %q", providerName, name)
+	}
+	var result AnalysisResult
+	if err := json.Unmarshal(args, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s arguments from %s response: %w", reportIssuesTool, providerName, err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// TrackingIssueConfig configures the issue that receives the report when a
+// run reports to an issue instead of a pull request, e.g. for scheduled
+// scans.
+type TrackingIssueConfig struct {
+	// Title defaults to "Semantic linting report".
+	Title string `json:"title"`
+	// Labels are applied to a newly created issue.
+	Labels []string `json:"labels"`
+	// Drift reports only what changed since the findings of the previous
+	// run, which are stored in the issue as a baseline.
+	Drift bool `json:"drift"`
+}
+
+const (
+	trackingIssueMarker       = "<!-- semantic-lint:tracking-issue -->"
+	defaultTrackingIssueTitle = "Semantic linting report"
+)
+
+// postTrackingIssue updates the open tracking issue found by its marker, or
+// opens a new one. patches maps filenames to the analyzed patches, whose
+// source identifies issues across drift reports.
+func postTrackingIssue(ctx context.Context, client *github.Client, owner, repo string, report *Report, patches map[string]string, config *Config) error {
+	title := config.TrackingIssue.Title
+	if title == "" {
+		title = defaultTrackingIssueTitle
+	}
+	existing, err := findTrackingIssue(ctx, client, owner, repo, config.TrackingIssue.Labels)
+	if err != nil {
+		return err
+	}
+
+	var body string
+	if config.TrackingIssue.Drift {
+		body, err = renderDriftIssue(report, patches, existing, config)
+		if err != nil {
+			return err
+		}
+	} else {
+		body = truncate(trackingIssueMarker+"\n"+renderComment(report, config), maxCommentLength)
+	}
+	if existing != nil {
+		_, _, err = client.Issues.Edit(ctx, owner, repo, existing.GetNumber(), &github.IssueRequest{
+			Title: &title,
+			Body:  &body,
+		})
+		return err
+	}
+
+	labels := config.TrackingIssue.Labels
+	_, _, err = client.Issues.Create(ctx, owner, repo, &github.IssueRequest{
+		Title:  &title,
+		Body:   &body,
+		Labels: &labels,
+	})
+	return err
+}
+
+// findTrackingIssue returns the open tracking issue the token's identity
+// opened, or nil. Issues others open with the marker are ignored, so no one
+// can plant a baseline or have their issue overwritten.
+func findTrackingIssue(ctx context.Context, client *github.Client, owner, repo string, labels []string) (*github.Issue, error) {
+	login, err := tokenLogin(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	opts := &github.IssueListByRepoOptions{
+		State:       "open",
+		Labels:      labels,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if !issue.IsPullRequest() && writtenBy(issue.GetUser(), login) && strings.HasPrefix(issue.GetBody(), trackingIssueMarker) {
+				return issue, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// renderDriftIssue renders the drift report against the baseline stored in
+// the existing tracking issue, if any, and stores the current findings as
+// the next baseline. A baseline too large for the issue is not stored.
+func renderDriftIssue(report *Report, patches map[string]string, existing *github.Issue, config *Config) (string, error) {
+	var previous *Baseline
+	if existing != nil {
+		var baseline Baseline
+		found, err := decodeHiddenData(existing.GetBody(), "baseline", &baseline)
+		if err != nil {
+			fmt.Printf("Ignoring unreadable baseline: %v\n", err)
+		} else if found {
+			previous = &baseline
+		}
+	}
+
+	state, err := encodeHiddenData("baseline", newBaseline(report, patches, previous))
+	if err != nil {
+		return "", err
+	}
+	if len(state) > maxBaselineLength {
+		fmt.Println("::warning::The findings are too large to store as a baseline.")
+		state = ""
+	}
+	body := trackingIssueMarker + "\n" + renderDriftReport(report, patches, previous, config)
+	return truncate(body, maxCommentLength-len(state)-1) + "\n" + state, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// authHeaders are never overridden by configured gateway headers and are
+// always redacted when tracing.
+var authHeaders = map[string]bool{
+	"Authorization":  true,
+	"X-Api-Key":      true,
+	"Api-Key":        true,
+	"X-Goog-Api-Key": true,
+}
+
+// headerTransport adds the configured gateway headers to outbound provider
+// requests and, when the runner has debug logging enabled, traces them with
+// sensitive values redacted.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	trace   bool
+}
+
+func newHeaderTransport(base http.RoundTripper, headers map[string]string) *headerTransport {
+	return &headerTransport{
+		base:    base,
+		headers: headers,
+		trace:   os.Getenv("RUNNER_DEBUG") == "1",
+	}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) > 0 {
+		// RoundTrippers must not modify the caller's request.
+		req = req.Clone(req.Context())
+		for key, value := range t.headers {
+			key = http.CanonicalHeaderKey(key)
+			if authHeaders[key] || req.Header.Get(key) != "" {
+				continue
+			}
+			req.Header.Set(key, value)
+		}
+	}
+
+	if t.trace {
+		fmt.Fprintf(progress, "::debug::%s %s %s\n", req.Method, redactURL(req.URL), t.redactedHeaders(req.Header))
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *headerTransport) redactedHeaders(header http.Header) string {
+	custom := make(map[string]bool, len(t.headers))
+	for key := range t.headers {
+		custom[http.CanonicalHeaderKey(key)] = true
+	}
+
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(header[key], ",")
+		if authHeaders[key] || custom[key] {
+			value = "[REDACTED]"
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// redactURL hides API keys passed as query parameters, as the Gemini
+// endpoint does.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if query.Has("key") {
+		query.Set("key", "REDACTED")
+	}
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
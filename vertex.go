@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// VertexConfig sends Gemini requests through Vertex AI in a GCP project
+// instead of the API-key based Gemini API.
+type VertexConfig struct {
+	Project  string `json:"project"`
+	Location string `json:"location"`
+	// CredentialsFile is a Google credentials file, such as a service
+	// account key. Defaults to GOOGLE_APPLICATION_CREDENTIALS. Without one,
+	// the AI API key input is used as an OAuth access token.
+	CredentialsFile string `json:"credentialsFile"`
+}
+
+const (
+	defaultVertexModel = "gemini-1.5-pro"
+	vertexScope        = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+func (c *VertexConfig) endpoint(model string) string {
+	if model == "" {
+		model = defaultVertexModel
+	}
+	return fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/%s:generateContent",
+		c.Location, c.Project, c.Location, model)
+}
+
+// vertexTokenSource returns a token source for the credentials file, or nil
+// when there is none and the API key is the access token. Any type of
+// Google credentials file works: a service account key, or the
+// external_account file google-github-actions/auth writes for workload
+// identity federation.
+func vertexTokenSource(ctx context.Context, config *VertexConfig) (oauth2.TokenSource, error) {
+	if config.Project == "" || config.Location == "" {
+		return nil, fmt.Errorf("ai.gemini.vertex.project and ai.gemini.vertex.location are required")
+	}
+	path := config.CredentialsFile
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GCP credentials: %w", err)
+	}
+	credentials, err := google.CredentialsFromJSON(ctx, data, vertexScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GCP credentials: %w", err)
+	}
+	return credentials.TokenSource, nil
+}
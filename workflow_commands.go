@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printWorkflowAnnotations prints every issue as an ::error or ::warning
+// workflow command. The runner turns these into annotations on the files,
+// which needs no token permissions, so it also works on pull requests from
+// forks. With warningsOnly, errors are printed as warnings too.
+func printWorkflowAnnotations(results []*FileAnalysisResult, config *Config, warningsOnly bool) {
+	for _, result := range fileResults(results) {
+		for _, issue := range result.Issues {
+			command := "warning"
+			if issueSeverity(issue, config) == "error" && !warningsOnly {
+				command = "error"
+			}
+			properties := []string{"file=" + escapeWorkflowProperty(result.Filename)}
+			if issue.Line > 0 {
+				properties = append(properties, fmt.Sprintf("line=%d", issue.Line))
+				if issue.EndLine > issue.Line {
+					properties = append(properties, fmt.Sprintf("endLine=%d", issue.EndLine))
+				}
+			}
+			properties = append(properties, "title="+escapeWorkflowProperty(issue.Type))
+
+			message := issue.Message
+			if issue.Suggestion != "" {
+				message += "\nSuggestion: " + issue.Suggestion
+			}
+			fmt.Printf("::%s %s::%s\n", command, strings.Join(properties, ","), escapeWorkflowData(message))
+		}
+	}
+}
+
+// escapeWorkflowData escapes the message of a workflow command.
+func escapeWorkflowData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeWorkflowProperty escapes a property value of a workflow command,
+// which additionally can't contain the separators.
+func escapeWorkflowProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeWorkflowData(s))
+}
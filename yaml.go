@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAMLConfig reports whether a config file is YAML, by its extension.
+// Any other config file is JSON.
+func isYAMLConfig(configPath string) bool {
+	switch strings.ToLower(path.Ext(configPath)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// configJSON returns the content of a config file as JSON. A YAML file is
+// converted, so the JSON field names are the one schema of both formats
+// and YAML block scalars can hold multi-line prompt templates.
+func configJSON(configPath string, content []byte) ([]byte, error) {
+	if !isYAMLConfig(configPath) {
+		return content, nil
+	}
+	var value any
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		// An empty file is an empty config, like {}.
+		return []byte("{}"), nil
+	}
+	return json.Marshal(jsonValue(value))
+}
+
+// jsonValue converts a decoded YAML value for encoding as JSON. Mappings
+// with keys other than strings, such as numbers, get their keys as text.
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	}
+	return value
+}